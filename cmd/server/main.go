@@ -11,6 +11,7 @@ import (
 	"google.golang.org/protobuf/encoding/protojson"
 
 	"github.com/livekit/livekit-recorder/pkg/config"
+	"github.com/livekit/livekit-recorder/pkg/display"
 	"github.com/livekit/livekit-recorder/version"
 )
 
@@ -43,6 +44,11 @@ func main() {
 				Usage:   "StartRecordingRequest json",
 				EnvVars: []string{"RECORDING_REQUEST"},
 			},
+			&cli.StringFlag{
+				Name:    "request-options",
+				Usage:   "recorder specific request options in JSON or yaml, overriding config defaults",
+				EnvVars: []string{"RECORDING_REQUEST_OPTIONS"},
+			},
 		},
 		Action:  run,
 		Version: version.Version,
@@ -54,6 +60,10 @@ func main() {
 }
 
 func run(c *cli.Context) error {
+	// clean up after a previous instance which crashed, and make sure nothing outlives this one
+	display.CleanupOrphans()
+	defer display.StopAll()
+
 	if c.Bool("service-mode") {
 		return runService(c)
 	}
@@ -99,3 +109,7 @@ func getRequest(c *cli.Context) (*livekit.StartRecordingRequest, error) {
 	err = protojson.Unmarshal(content, req)
 	return req, err
 }
+
+func getRequestOptions(c *cli.Context) (*config.RequestOptions, error) {
+	return config.NewRequestOptions(c.String("request-options"))
+}
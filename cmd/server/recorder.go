@@ -22,8 +22,13 @@ func runRecorder(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	opts, err := getRequestOptions(c)
+	if err != nil {
+		return err
+	}
 
 	rec := recorder.NewRecorder(conf, "standalone")
+	rec.SetRequestOptions(opts)
 	if err = rec.Validate(req); err != nil {
 		return err
 	}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -54,6 +55,20 @@ type handler struct {
 	svc *service.Service
 }
 
-func (h *handler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+type healthResponse struct {
+	Status service.Status       `json:"status"`
+	Slots  []service.SlotStatus `json:"slots"`
+}
+
+// ServeHTTP returns the service status as plain text, or the status of every slot as json on /slots
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/slots" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&healthResponse{
+			Status: h.svc.Status(),
+			Slots:  h.svc.SlotStatus(),
+		})
+		return
+	}
 	_, _ = w.Write([]byte(h.svc.Status()))
 }
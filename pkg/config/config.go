@@ -1,16 +1,17 @@
 package config
 
 import (
+	"errors"
 	"fmt"
-	"math/rand"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/go-logr/zapr"
 	"github.com/livekit/protocol/livekit"
 	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/utils"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"gopkg.in/yaml.v3"
@@ -22,6 +23,77 @@ const (
 	ProfileHigh     = "high"
 )
 
+const (
+	SourceScreen = "screen"
+	SourceTest   = "test"
+	SourceFile   = "file"
+)
+
+var validSources = map[string]bool{
+	SourceScreen: true,
+	SourceTest:   true,
+	SourceFile:   true,
+}
+
+const (
+	// CaptureX11 captures chrome's window on an Xvfb display
+	CaptureX11 = "x11"
+	// CaptureScreencast runs chrome headless, and captures frames sent over the devtools protocol
+	CaptureScreencast = "screencast"
+)
+
+const (
+	TemplatesEmbedded = "embedded"
+	TemplatesRemote   = "remote"
+)
+
+const (
+	CrashReload = "reload"
+	CrashEnd    = "end"
+)
+
+var defaultCrashPolicy = CrashPolicy{
+	Action:     CrashReload,
+	MaxReloads: 3,
+}
+
+const (
+	PageErrorEnd    = "end"
+	PageErrorIgnore = "ignore"
+)
+
+var defaultPageErrorPolicy = PageErrorPolicy{
+	Action:          PageErrorEnd,
+	InitialPageOnly: true,
+}
+
+const (
+	AnalysisAnnotate = "annotate"
+	AnalysisStop     = "stop"
+)
+
+var defaultAnalysis = Analysis{
+	SilenceLevel: -60,
+	Action:       AnalysisAnnotate,
+}
+
+var defaultReadiness = Readiness{
+	Timeout: time.Second * 30,
+}
+
+var defaultTimeouts = Timeouts{
+	Reservation: time.Second * 10,
+	Playing:     time.Second * 30,
+	EOS:         time.Second * 30,
+	Shutdown:    time.Minute,
+}
+
+var defaultDiskSpace = DiskSpaceConfig{
+	WarnThreshold: 2 << 30,
+	StopThreshold: 512 << 20,
+	CheckInterval: time.Second * 5,
+}
+
 var validProfiles = map[string]bool{
 	ProfileBaseline: true,
 	ProfileMain:     true,
@@ -29,17 +101,27 @@ var validProfiles = map[string]bool{
 }
 
 type Config struct {
-	ApiKey          string      `yaml:"api_key"`
-	ApiSecret       string      `yaml:"api_secret"`
-	WsUrl           string      `yaml:"ws_url"`
-	HealthPort      int         `yaml:"health_port"`
-	LogLevel        string      `yaml:"log_level"`
-	TemplateAddress string      `yaml:"template_address"`
-	Insecure        bool        `yaml:"insecure"`
-	Redis           RedisConfig `yaml:"redis"`
-	FileOutput      FileOutput  `yaml:"file_output"`
-	Defaults        Defaults    `yaml:"defaults"`
-	Display         string      `yaml:"-"`
+	ApiKey          string          `yaml:"api_key"`
+	ApiSecret       string          `yaml:"api_secret"`
+	WsUrl           string          `yaml:"ws_url"`
+	HealthPort      int             `yaml:"health_port"`
+	Capacity        int             `yaml:"capacity"`
+	LogLevel        string          `yaml:"log_level"`
+	TemplateAddress string          `yaml:"template_address"`
+	Templates       Templates       `yaml:"templates"`
+	Participant     Participant     `yaml:"participant"`
+	Chrome          Chrome          `yaml:"chrome"`
+	BrowserLog      BrowserLog      `yaml:"browser_log"`
+	Diagnostics     Diagnostics     `yaml:"diagnostics"`
+	Insecure        bool            `yaml:"insecure"`
+	Redis           RedisConfig     `yaml:"redis"`
+	FileOutput      FileOutput      `yaml:"file_output"`
+	Defaults        Defaults        `yaml:"defaults"`
+	Timeouts        Timeouts        `yaml:"timeouts"`
+	Source          Source          `yaml:"source"`
+	DiskSpace       DiskSpaceConfig `yaml:"disk_space"`
+	OnCrash         CrashPolicy     `yaml:"on_crash"`
+	OnPageError     PageErrorPolicy `yaml:"on_page_error"`
 }
 
 type RedisConfig struct {
@@ -49,11 +131,84 @@ type RedisConfig struct {
 	DB       int    `yaml:"db"`
 }
 
+// FileOutput is where file recordings end up. Recordings are kept locally unless one storage is configured.
 type FileOutput struct {
-	Local     bool          `yaml:"local"`
-	S3        *S3Config     `yaml:"s3"`
-	Azblob    *AzblobConfig `yaml:"azblob"`
-	GCPConfig *GCPConfig    `yaml:"gcp"`
+	Local     bool             `yaml:"local"`
+	S3        *S3Config        `yaml:"s3"`
+	Azblob    *AzblobConfig    `yaml:"azblob"`
+	GCPConfig *GCPConfig       `yaml:"gcp"`
+	SFTP      *SFTPConfig      `yaml:"sftp"`
+	WebDAV    *WebDAVConfig    `yaml:"webdav"`
+	Gateway   *GatewayConfig   `yaml:"gateway"`
+	Directory *DirectoryConfig `yaml:"directory"`
+}
+
+// DiskSpaceConfig guards local recordings and upload staging against filling the disk
+type DiskSpaceConfig struct {
+	WarnThreshold int64         `yaml:"warn_threshold"` // bytes free below which a warning is logged
+	StopThreshold int64         `yaml:"stop_threshold"` // bytes free below which the recording is stopped
+	CheckInterval time.Duration `yaml:"check_interval"`
+}
+
+// Templates chooses where template inputs are loaded from
+type Templates struct {
+	Source        string                       `yaml:"source"`         // embedded, served locally by the recorder, or remote, at template_address
+	Dir           string                       `yaml:"dir"`            // custom layouts for embedded templates, overriding built-in files with the same path
+	AllowedParams []string                     `yaml:"allowed_params"` // query params requests may pass to templates
+	LayoutParams  map[string]map[string]string `yaml:"layout_params"`  // default params for each layout
+}
+
+// BrowserLog saves console messages, exceptions and failed requests from the page next to file recordings
+type BrowserLog struct {
+	Enabled bool `yaml:"enabled"`
+	Network bool `yaml:"network"` // also log every successful request, with its status, size and duration
+}
+
+// Diagnostics bundles are collected when a recording fails, and saved with the configured file output
+type Diagnostics struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"` // storage prefix, or absolute local directory
+}
+
+// Participant describes the hidden participant which joins rooms for template inputs
+type Participant struct {
+	IdentityPrefix string `yaml:"identity_prefix"` // followed by a random id
+	Metadata       string `yaml:"metadata"`
+}
+
+// Chrome configures the browser which loads the page
+type Chrome struct {
+	Path     string            `yaml:"path"`     // chrome binary, found on PATH by default
+	Flags    []string          `yaml:"flags"`    // extra flags, e.g. --lang=en-US. --name=false removes a default flag.
+	Profiles map[string]string `yaml:"profiles"` // persistent profile directories by name, for pages which need a login
+}
+
+// reservedFlags are set by the recorder itself
+var reservedFlags = map[string]bool{
+	"display":               true,
+	"user-data-dir":         true,
+	"remote-debugging-port": true,
+	"remote-debugging-pipe": true,
+	"window-size":           true,
+	"window-position":       true,
+}
+
+// reservedParams are set by the recorder itself
+var reservedParams = map[string]bool{
+	"url":   true,
+	"token": true,
+}
+
+// CrashPolicy decides what happens when the page being recorded crashes
+type CrashPolicy struct {
+	Action     string `yaml:"action"`      // reload or end
+	MaxReloads int    `yaml:"max_reloads"` // reloads allowed per recording before ending it
+}
+
+// PageErrorPolicy decides whether error events sent by the page end the recording
+type PageErrorPolicy struct {
+	Action          string `yaml:"action"`            // end or ignore
+	InitialPageOnly bool   `yaml:"initial_page_only"` // ignore errors from pages loaded by navigate requests
 }
 
 type S3Config struct {
@@ -74,6 +229,53 @@ type GCPConfig struct {
 	Bucket string `yaml:"bucket"`
 }
 
+type SFTPConfig struct {
+	Address    string        `yaml:"address"` // host:port
+	Username   string        `yaml:"username"`
+	Password   string        `yaml:"password"`
+	PrivateKey string        `yaml:"private_key"` // pem encoded, used instead of or along with the password
+	HostKey    string        `yaml:"host_key"`    // server public key, in authorized_keys format
+	Dir        string        `yaml:"dir"`         // remote directory, defaults to the login directory
+	Timeout    time.Duration `yaml:"timeout"`     // per file, including connecting. Defaults to 1h
+}
+
+type WebDAVConfig struct {
+	Url      string        `yaml:"url"` // collection files are uploaded to
+	Username string        `yaml:"username"`
+	Password string        `yaml:"password"`
+	Timeout  time.Duration `yaml:"timeout"` // per request, including the file. Defaults to 1h
+}
+
+// GatewayConfig uploads each file with a PUT to an upload gateway, which decides where it is stored.
+// Presigned urls are given per recording instead, in RequestOptions.UploadUrls.
+type GatewayConfig struct {
+	Url     string            `yaml:"url"` // {path} is replaced with the storage path
+	Headers map[string]string `yaml:"headers"`
+	Timeout time.Duration     `yaml:"timeout"` // per request, including the file. Defaults to 1h
+}
+
+// DirectoryConfig moves files to a local directory, e.g. an nfs mount
+type DirectoryConfig struct {
+	Path string `yaml:"path"`
+}
+
+// Source selects what gets captured. Anything other than screen runs without Chrome, Xvfb or PulseAudio.
+type Source struct {
+	Type         string  `yaml:"type"`          // screen, test, or file
+	Capture      string  `yaml:"capture"`       // x11 or screencast (screen only)
+	VideoPattern string  `yaml:"video_pattern"` // videotestsrc pattern (test only)
+	AudioTone    float64 `yaml:"audio_tone"`    // audiotestsrc frequency in Hz (test only)
+	File         string  `yaml:"file"`          // local media file (file only)
+}
+
+// Timeouts bound each stage of starting and stopping a recording. A zero value disables the timeout.
+type Timeouts struct {
+	Reservation time.Duration `yaml:"reservation"` // time allowed between a reservation and its start request
+	Playing     time.Duration `yaml:"playing"`     // time allowed for the pipeline to reach PLAYING
+	EOS         time.Duration `yaml:"eos"`         // time allowed to drain after EOS before forcing the pipeline to NULL
+	Shutdown    time.Duration `yaml:"shutdown"`    // time allowed between Stop and the pipeline finishing
+}
+
 type Defaults struct {
 	Preset         livekit.RecordingPreset `yaml:"preset"`
 	Width          int32                   `yaml:"width"`
@@ -84,13 +286,88 @@ type Defaults struct {
 	AudioFrequency int32                   `yaml:"audio_frequency"`
 	VideoBitrate   int32                   `yaml:"video_bitrate"`
 	Profile        string                  `yaml:"profile"`
+	MaxDuration    time.Duration           `yaml:"max_duration"`  // 0 for no limit
+	MaxFileSize    int64                   `yaml:"max_file_size"` // bytes, 0 for no limit
+	Readiness      Readiness               `yaml:"readiness"`
+	StartTimeout   time.Duration           `yaml:"start_timeout"`    // time allowed for a template room to start
+	EmptyRoomGrace time.Duration           `yaml:"empty_room_grace"` // time to wait for a participant to rejoin
+	Page           Page                    `yaml:"page"`
+	Analysis       Analysis                `yaml:"analysis"`
+}
+
+// Analysis watches the recorded audio and video for dead content. Conditions with no duration are not detected.
+type Analysis struct {
+	Blank        time.Duration `yaml:"blank"`         // sustained black or uniform frames
+	Frozen       time.Duration `yaml:"frozen"`        // sustained unchanged frames
+	Silence      time.Duration `yaml:"silence"`       // sustained audio below silence_level
+	SilenceLevel float64       `yaml:"silence_level"` // dB
+	Action       string        `yaml:"action"`        // annotate the metadata, or stop the recording
+}
+
+// Readiness delays capturing a url input until the page is ready. Every condition set must be met,
+// followed by the delay, within the timeout.
+type Readiness struct {
+	Selector       string        `yaml:"selector"`        // css selector which must be visible
+	NetworkIdle    bool          `yaml:"network_idle"`    // wait for the page's network to go idle
+	Predicate      string        `yaml:"predicate"`       // js expression which must return true
+	ConsoleMessage string        `yaml:"console_message"` // console message the page logs once ready
+	Delay          time.Duration `yaml:"delay"`           // fixed delay once other conditions are met
+	Timeout        time.Duration `yaml:"timeout"`
+}
+
+// Page customizes how the recorded page is loaded. Header values, cookie values and passwords are secrets,
+// and must not be logged.
+type Page struct {
+	Cookies   []Cookie          `yaml:"cookies"`
+	Headers   map[string]string `yaml:"headers"` // extra http headers sent with requests to the page's origin
+	BasicAuth *BasicAuth        `yaml:"basic_auth"`
+	UserAgent string            `yaml:"user_agent"`
+	Profile   string            `yaml:"profile"` // persistent chrome profile, from chrome.profiles
+	Scripts   []string          `yaml:"scripts"` // js run on every new document, before the page's own scripts
+	Styles    []string          `yaml:"styles"`  // css added to every document
+}
+
+type Cookie struct {
+	Name     string `yaml:"name"`
+	Value    string `yaml:"value"`
+	Domain   string `yaml:"domain"` // defaults to the page's host
+	Path     string `yaml:"path"`
+	Secure   bool   `yaml:"secure"`
+	HTTPOnly bool   `yaml:"http_only"`
+}
+
+type BasicAuth struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// RequestOptions are recorder specific options which are not part of a StartRecordingRequest.
+// Unset values fall back to Defaults. Limits and timeouts are pointers, so a request can set them to 0.
+type RequestOptions struct {
+	MaxDuration    *time.Duration `yaml:"max_duration,omitempty"`
+	MaxFileSize    *int64         `yaml:"max_file_size,omitempty"`
+	Readiness      Readiness      `yaml:"readiness"`
+	StartTimeout   *time.Duration `yaml:"start_timeout,omitempty"`
+	EmptyRoomGrace *time.Duration `yaml:"empty_room_grace,omitempty"`
+	Page           Page           `yaml:"page"`
+	Analysis       Analysis       `yaml:"analysis"`
+
+	// query params for template inputs, added to the layout's defaults
+	TemplateParams map[string]string `yaml:"template_params"`
+
+	// presigned PUT urls for this recording's files, by storage path
+	UploadUrls map[string]string `yaml:"upload_urls"`
 }
 
 func NewConfig(confString string) (*Config, error) {
 	// start with defaults
 	conf := &Config{
 		LogLevel:        "info",
+		Capacity:        1,
 		TemplateAddress: "https://recorder.livekit.io/#",
+		Templates:       Templates{Source: TemplatesEmbedded},
+		Participant:     Participant{IdentityPrefix: utils.RecordingPrefix},
+		Diagnostics:     Diagnostics{Path: "diagnostics"},
 		Defaults: Defaults{
 			Width:          1920,
 			Height:         1080,
@@ -100,7 +377,20 @@ func NewConfig(confString string) (*Config, error) {
 			AudioFrequency: 44100,
 			VideoBitrate:   4500,
 			Profile:        ProfileMain,
+			Readiness:      defaultReadiness,
+			Analysis:       defaultAnalysis,
+			StartTimeout:   time.Minute * 10,
+			EmptyRoomGrace: time.Second * 10,
+		},
+		Timeouts: defaultTimeouts,
+		Source: Source{
+			Type:      SourceScreen,
+			Capture:   CaptureX11,
+			AudioTone: 440,
 		},
+		DiskSpace:   defaultDiskSpace,
+		OnCrash:     defaultCrashPolicy,
+		OnPageError: defaultPageErrorPolicy,
 	}
 
 	if confString != "" {
@@ -109,19 +399,87 @@ func NewConfig(confString string) (*Config, error) {
 		}
 	}
 
-	// apply preset options
-	if conf.FileOutput.S3 == nil && conf.FileOutput.Azblob == nil && conf.FileOutput.GCPConfig == nil {
+	if err := conf.FileOutput.validate(); err != nil {
+		return nil, err
+	}
+	if conf.FileOutput.storageCount() == 0 {
 		conf.FileOutput.Local = true
 	}
+	if conf.Diagnostics.Enabled && conf.FileOutput.Local && !filepath.IsAbs(conf.Diagnostics.Path) {
+		return nil, errors.New("diagnostics path must be an absolute directory when no storage is configured")
+	}
 
+	// apply preset options
 	if conf.Defaults.Preset != livekit.RecordingPreset_NONE {
-		conf.Defaults = fromProto(fromPreset(conf.Defaults.Preset))
+		conf.Defaults.setOptions(fromPreset(conf.Defaults.Preset))
+	}
+
+	if conf.Defaults.MaxDuration < 0 || conf.Defaults.MaxFileSize < 0 {
+		return nil, errors.New("limits cannot be negative")
+	}
+	if conf.Defaults.StartTimeout < 0 || conf.Defaults.EmptyRoomGrace < 0 {
+		return nil, errors.New("start_timeout and empty_room_grace cannot be negative")
 	}
 
 	if !validProfiles[conf.Defaults.Profile] {
 		return nil, fmt.Errorf("invalid profile %s", conf.Defaults.Profile)
 	}
 
+	if conf.Capacity < 1 {
+		return nil, errors.New("capacity must be at least 1")
+	}
+
+	if conf.Timeouts.Reservation < 0 || conf.Timeouts.Playing < 0 ||
+		conf.Timeouts.EOS < 0 || conf.Timeouts.Shutdown < 0 {
+		return nil, errors.New("timeouts cannot be negative")
+	}
+
+	if conf.DiskSpace.WarnThreshold < conf.DiskSpace.StopThreshold {
+		return nil, errors.New("disk space warn_threshold must be at least stop_threshold")
+	}
+	if conf.DiskSpace.CheckInterval <= 0 {
+		return nil, errors.New("disk space check_interval must be positive")
+	}
+
+	if err := conf.Source.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := conf.Defaults.Readiness.Validate(); err != nil {
+		return nil, err
+	}
+	if err := conf.Defaults.Page.validate(); err != nil {
+		return nil, err
+	}
+	if err := conf.Defaults.Analysis.validate(); err != nil {
+		return nil, err
+	}
+
+	if conf.Participant.IdentityPrefix == "" {
+		return nil, errors.New("participant identity_prefix required")
+	}
+
+	if err := conf.Templates.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := conf.Chrome.validate(); err != nil {
+		return nil, err
+	}
+	if _, err := conf.Chrome.ProfileDir(conf.Defaults.Page.Profile); err != nil {
+		return nil, err
+	}
+
+	if conf.OnCrash.Action != CrashReload && conf.OnCrash.Action != CrashEnd {
+		return nil, fmt.Errorf("invalid on_crash action %s", conf.OnCrash.Action)
+	}
+	if conf.OnCrash.MaxReloads < 0 {
+		return nil, errors.New("on_crash max_reloads cannot be negative")
+	}
+	if conf.OnPageError.Action != PageErrorEnd && conf.OnPageError.Action != PageErrorIgnore {
+		return nil, fmt.Errorf("invalid on_page_error action %s", conf.OnPageError.Action)
+	}
+
 	// GStreamer log level
 	if os.Getenv("GST_DEBUG") == "" {
 		var gstDebug int
@@ -139,8 +497,7 @@ func NewConfig(confString string) (*Config, error) {
 	}
 
 	conf.initLogger()
-	err := conf.initDisplay()
-	return conf, err
+	return conf, nil
 }
 
 func TestConfig() (*Config, error) {
@@ -148,7 +505,11 @@ func TestConfig() (*Config, error) {
 		ApiKey:          "fakeKey",
 		ApiSecret:       "fakeSecret",
 		LogLevel:        "debug",
+		Capacity:        1,
 		TemplateAddress: "https://recorder.livekit.io/#",
+		Templates:       Templates{Source: TemplatesRemote},
+		Participant:     Participant{IdentityPrefix: utils.RecordingPrefix},
+		Diagnostics:     Diagnostics{Path: "diagnostics"},
 		Redis: RedisConfig{
 			Address: "localhost:6379",
 		},
@@ -161,33 +522,81 @@ func TestConfig() (*Config, error) {
 			AudioFrequency: 44100,
 			VideoBitrate:   4500,
 			Profile:        ProfileMain,
+			Readiness:      defaultReadiness,
+			Analysis:       defaultAnalysis,
+			StartTimeout:   time.Minute * 10,
+			EmptyRoomGrace: time.Second * 10,
+		},
+		Timeouts: defaultTimeouts,
+		Source: Source{
+			Type:      SourceScreen,
+			Capture:   CaptureX11,
+			AudioTone: 440,
 		},
+		DiskSpace:   defaultDiskSpace,
+		OnCrash:     defaultCrashPolicy,
+		OnPageError: defaultPageErrorPolicy,
 	}
 	conf.initLogger()
-	err := conf.initDisplay()
-	return conf, err
+	return conf, nil
 }
 
-func (c *Config) initDisplay() error {
-	d := os.Getenv("DISPLAY")
-	if d != "" && strings.HasPrefix(d, ":") {
-		num, err := strconv.Atoi(d[1:])
-		if err == nil && num > 0 && num <= 2147483647 {
-			c.Display = d
-			return nil
+// storageCount returns the number of storage backends configured
+func (f *FileOutput) storageCount() int {
+	count := 0
+	for _, configured := range []bool{
+		f.S3 != nil, f.Azblob != nil, f.GCPConfig != nil,
+		f.SFTP != nil, f.WebDAV != nil, f.Gateway != nil, f.Directory != nil,
+	} {
+		if configured {
+			count++
 		}
 	}
+	return count
+}
 
-	if c.Display == "" {
-		rand.Seed(time.Now().UnixNano())
-		c.Display = fmt.Sprintf(":%d", 10+rand.Intn(2147483637))
+func (f *FileOutput) validate() error {
+	if f.storageCount() > 1 {
+		return errors.New("only one file_output storage can be set")
 	}
-
-	// GStreamer uses display from env
-	if err := os.Setenv("DISPLAY", c.Display); err != nil {
-		return err
+	if f.SFTP != nil {
+		if f.SFTP.Address == "" || f.SFTP.Username == "" {
+			return errors.New("sftp address and username required")
+		}
+		if f.SFTP.Password == "" && f.SFTP.PrivateKey == "" {
+			return errors.New("sftp password or private_key required")
+		}
+		if f.SFTP.HostKey == "" {
+			return errors.New("sftp host_key required")
+		}
+	}
+	if f.WebDAV != nil && f.WebDAV.Url == "" {
+		return errors.New("webdav url required")
 	}
+	if f.Gateway != nil && !strings.Contains(f.Gateway.Url, "{path}") {
+		return errors.New("gateway url must contain {path}")
+	}
+	if f.Directory != nil && f.Directory.Path == "" {
+		return errors.New("directory path required")
+	}
+	return nil
+}
 
+func (s *Source) validate() error {
+	if !validSources[s.Type] {
+		return fmt.Errorf("invalid source type %s", s.Type)
+	}
+	if s.Capture != CaptureX11 && s.Capture != CaptureScreencast {
+		return fmt.Errorf("invalid source capture %s", s.Capture)
+	}
+	if s.Type == SourceFile {
+		if s.File == "" {
+			return errors.New("file required for file source")
+		}
+		if _, err := os.Stat(s.File); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -238,6 +647,299 @@ func (c *Config) ApplyDefaults(req *livekit.StartRecordingRequest) {
 	return
 }
 
+// NewRequestOptions parses request options from yaml or json
+func NewRequestOptions(body string) (*RequestOptions, error) {
+	opts := &RequestOptions{}
+	if body != "" {
+		if err := yaml.Unmarshal([]byte(body), opts); err != nil {
+			return nil, fmt.Errorf("could not parse request options: %v", err)
+		}
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// Validate checks options which did not come from NewRequestOptions
+func (o *RequestOptions) Validate() error {
+	if o.GetMaxDuration() < 0 || o.GetMaxFileSize() < 0 {
+		return errors.New("limits cannot be negative")
+	}
+	if o.GetStartTimeout() < 0 || o.GetEmptyRoomGrace() < 0 {
+		return errors.New("start_timeout and empty_room_grace cannot be negative")
+	}
+	if err := o.Readiness.Validate(); err != nil {
+		return err
+	}
+	if err := o.Page.validate(); err != nil {
+		return err
+	}
+	for storagePath, location := range o.UploadUrls {
+		if !strings.HasPrefix(location, "https://") && !strings.HasPrefix(location, "http://") {
+			return fmt.Errorf("upload url for %s must be http(s)", storagePath)
+		}
+	}
+	return o.Analysis.validate()
+}
+
+func (c *Config) ApplyRequestDefaults(opts *RequestOptions) {
+	if opts.MaxDuration == nil {
+		maxDuration := c.Defaults.MaxDuration
+		opts.MaxDuration = &maxDuration
+	}
+	if opts.MaxFileSize == nil {
+		maxFileSize := c.Defaults.MaxFileSize
+		opts.MaxFileSize = &maxFileSize
+	}
+	if opts.StartTimeout == nil {
+		startTimeout := c.Defaults.StartTimeout
+		opts.StartTimeout = &startTimeout
+	}
+	if opts.EmptyRoomGrace == nil {
+		emptyRoomGrace := c.Defaults.EmptyRoomGrace
+		opts.EmptyRoomGrace = &emptyRoomGrace
+	}
+
+	// readiness conditions are replaced as a whole, since they only make sense together
+	timeout := opts.Readiness.Timeout
+	if !opts.Readiness.Enabled() {
+		opts.Readiness = c.Defaults.Readiness
+	}
+	if timeout != 0 {
+		opts.Readiness.Timeout = timeout
+	} else if opts.Readiness.Timeout == 0 {
+		opts.Readiness.Timeout = c.Defaults.Readiness.Timeout
+	}
+
+	opts.Page = c.Defaults.Page.merge(&opts.Page)
+	opts.Analysis = c.Defaults.Analysis.merge(&opts.Analysis)
+}
+
+// GetMaxDuration returns 0 if unset
+func (o *RequestOptions) GetMaxDuration() time.Duration {
+	if o.MaxDuration == nil {
+		return 0
+	}
+	return *o.MaxDuration
+}
+
+// GetMaxFileSize returns 0 if unset
+func (o *RequestOptions) GetMaxFileSize() int64 {
+	if o.MaxFileSize == nil {
+		return 0
+	}
+	return *o.MaxFileSize
+}
+
+// GetStartTimeout returns 0 if unset
+func (o *RequestOptions) GetStartTimeout() time.Duration {
+	if o.StartTimeout == nil {
+		return 0
+	}
+	return *o.StartTimeout
+}
+
+// GetEmptyRoomGrace returns 0 if unset
+func (o *RequestOptions) GetEmptyRoomGrace() time.Duration {
+	if o.EmptyRoomGrace == nil {
+		return 0
+	}
+	return *o.EmptyRoomGrace
+}
+
+// merge overrides the defaults with any values set by the request
+func (a *Analysis) merge(req *Analysis) Analysis {
+	merged := *a
+	if req.Blank != 0 {
+		merged.Blank = req.Blank
+	}
+	if req.Frozen != 0 {
+		merged.Frozen = req.Frozen
+	}
+	if req.Silence != 0 {
+		merged.Silence = req.Silence
+	}
+	if req.SilenceLevel != 0 {
+		merged.SilenceLevel = req.SilenceLevel
+	}
+	if req.Action != "" {
+		merged.Action = req.Action
+	}
+	return merged
+}
+
+// Enabled returns true if any condition is detected
+func (a *Analysis) Enabled() bool {
+	return a.Blank > 0 || a.Frozen > 0 || a.Silence > 0
+}
+
+func (a *Analysis) validate() error {
+	if a.Blank < 0 || a.Frozen < 0 || a.Silence < 0 {
+		return errors.New("analysis durations cannot be negative")
+	}
+	if a.SilenceLevel > 0 {
+		return errors.New("analysis silence_level must be at most 0 dB")
+	}
+	if a.Action != "" && a.Action != AnalysisAnnotate && a.Action != AnalysisStop {
+		return fmt.Errorf("invalid analysis action %s", a.Action)
+	}
+	return nil
+}
+
+// merge adds request page options to the defaults. Lists are appended, and everything else is overridden.
+func (p *Page) merge(req *Page) Page {
+	merged := Page{
+		Cookies:   append(append([]Cookie{}, p.Cookies...), req.Cookies...),
+		Headers:   make(map[string]string, len(p.Headers)+len(req.Headers)),
+		BasicAuth: p.BasicAuth,
+		UserAgent: p.UserAgent,
+		Profile:   p.Profile,
+		Scripts:   append(append([]string{}, p.Scripts...), req.Scripts...),
+		Styles:    append(append([]string{}, p.Styles...), req.Styles...),
+	}
+	for k, v := range p.Headers {
+		merged.Headers[k] = v
+	}
+	for k, v := range req.Headers {
+		merged.Headers[k] = v
+	}
+	if req.BasicAuth != nil {
+		merged.BasicAuth = req.BasicAuth
+	}
+	if req.UserAgent != "" {
+		merged.UserAgent = req.UserAgent
+	}
+	if req.Profile != "" {
+		merged.Profile = req.Profile
+	}
+	return merged
+}
+
+func (p *Page) validate() error {
+	for _, c := range p.Cookies {
+		if c.Name == "" {
+			return errors.New("cookie name required")
+		}
+	}
+	return nil
+}
+
+// Enabled returns true if any readiness condition is set
+func (r *Readiness) Enabled() bool {
+	return r.Selector != "" || r.NetworkIdle || r.Predicate != "" || r.ConsoleMessage != "" || r.Delay > 0
+}
+
+// Validate checks readiness conditions from config, request options or navigate requests
+func (r *Readiness) Validate() error {
+	if r.Delay < 0 || r.Timeout < 0 {
+		return errors.New("readiness delay and timeout cannot be negative")
+	}
+	return nil
+}
+
+func (t *Templates) validate() error {
+	switch t.Source {
+	case TemplatesEmbedded:
+		if t.Dir != "" {
+			if info, err := os.Stat(t.Dir); err != nil || !info.IsDir() {
+				return fmt.Errorf("templates dir %s not found", t.Dir)
+			}
+		}
+	case TemplatesRemote:
+	default:
+		return fmt.Errorf("invalid templates source %s", t.Source)
+	}
+
+	for _, key := range t.AllowedParams {
+		if reservedParams[key] {
+			return fmt.Errorf("template param %s is reserved", key)
+		}
+	}
+	for layout, params := range t.LayoutParams {
+		for key := range params {
+			if reservedParams[key] {
+				return fmt.Errorf("template param %s for layout %s is reserved", key, layout)
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks the chrome binary, flags and profiles
+func (c *Chrome) validate() error {
+	if c.Path != "" {
+		if info, err := os.Stat(c.Path); err != nil || info.IsDir() {
+			return fmt.Errorf("chrome path %s not found", c.Path)
+		}
+	}
+	for _, flag := range c.Flags {
+		if _, _, err := ParseChromeFlag(flag); err != nil {
+			return err
+		}
+	}
+	for name, dir := range c.Profiles {
+		if name == "" || dir == "" {
+			return errors.New("chrome profiles require a name and a directory")
+		}
+	}
+	return nil
+}
+
+// ParseChromeFlag splits a flag such as --lang=en-US into its name and value.
+// Flags without a value are true, and --name=false removes a flag.
+func ParseChromeFlag(flag string) (string, interface{}, error) {
+	if !strings.HasPrefix(flag, "--") {
+		return "", nil, fmt.Errorf("invalid chrome flag %s", flag)
+	}
+	name, value := flag[2:], ""
+	hasValue := false
+	if i := strings.Index(name, "="); i >= 0 {
+		name, value, hasValue = name[:i], name[i+1:], true
+	}
+	if name == "" {
+		return "", nil, fmt.Errorf("invalid chrome flag %s", flag)
+	}
+	if reservedFlags[name] {
+		return "", nil, fmt.Errorf("chrome flag %s is set by the recorder", name)
+	}
+
+	switch {
+	case !hasValue || value == "true":
+		return name, true, nil
+	case value == "false":
+		return name, false, nil
+	default:
+		return name, value, nil
+	}
+}
+
+// ProfileDir returns the directory of a persistent profile. No name means a temporary profile.
+func (c *Chrome) ProfileDir(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	dir, ok := c.Profiles[name]
+	if !ok {
+		return "", fmt.Errorf("unknown chrome profile %s", name)
+	}
+	return dir, nil
+}
+
+// ParamAllowed returns true if requests may set the template param
+func (t *Templates) ParamAllowed(key string) bool {
+	if reservedParams[key] {
+		return false
+	}
+	for _, allowed := range t.AllowedParams {
+		if key == allowed {
+			return true
+		}
+	}
+	return false
+}
+
 func fromPreset(preset livekit.RecordingPreset) *livekit.RecordingOptions {
 	switch preset {
 	case livekit.RecordingPreset_HD_30:
@@ -289,15 +991,14 @@ func fromPreset(preset livekit.RecordingPreset) *livekit.RecordingOptions {
 	}
 }
 
-func fromProto(opts *livekit.RecordingOptions) Defaults {
-	return Defaults{
-		Width:          opts.Width,
-		Height:         opts.Height,
-		Depth:          opts.Depth,
-		Framerate:      opts.Framerate,
-		AudioBitrate:   opts.AudioBitrate,
-		AudioFrequency: opts.AudioFrequency,
-		VideoBitrate:   opts.VideoBitrate,
-		Profile:        opts.Profile,
-	}
+// setOptions replaces the encoding defaults, keeping any limits
+func (d *Defaults) setOptions(opts *livekit.RecordingOptions) {
+	d.Width = opts.Width
+	d.Height = opts.Height
+	d.Depth = opts.Depth
+	d.Framerate = opts.Framerate
+	d.AudioBitrate = opts.AudioBitrate
+	d.AudioFrequency = opts.AudioFrequency
+	d.VideoBitrate = opts.VideoBitrate
+	d.Profile = opts.Profile
 }
@@ -2,6 +2,7 @@ package config_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/livekit/protocol/livekit"
 	"github.com/stretchr/testify/require"
@@ -28,8 +29,136 @@ defaults:
   audio_frequency: 22050
   video_bitrate: 750
   profile: high
+timeouts:
+  eos: 10s
+on_crash:
+  action: end
 `
 
+func TestSource(t *testing.T) {
+	_, err := config.NewConfig("source:\n  type: camera")
+	require.Error(t, err)
+
+	_, err = config.NewConfig("source:\n  type: file")
+	require.Error(t, err)
+
+	conf, err := config.NewConfig("source:\n  type: test")
+	require.NoError(t, err)
+	require.Equal(t, 440.0, conf.Source.AudioTone)
+	require.Equal(t, config.CaptureX11, conf.Source.Capture)
+
+	conf, err = config.NewConfig("source:\n  capture: screencast")
+	require.NoError(t, err)
+	require.Equal(t, config.CaptureScreencast, conf.Source.Capture)
+
+	_, err = config.NewConfig("source:\n  capture: vnc")
+	require.Error(t, err)
+}
+
+func TestRequestOptions(t *testing.T) {
+	conf, err := config.NewConfig("defaults:\n  preset: 1\n  max_duration: 1h")
+	require.NoError(t, err)
+	require.Equal(t, int32(1280), conf.Defaults.Width)
+	require.Equal(t, time.Hour, conf.Defaults.MaxDuration)
+
+	opts, err := config.NewRequestOptions(`{"max_duration": "30m", "empty_room_grace": "1m"}`)
+	require.NoError(t, err)
+	conf.ApplyRequestDefaults(opts)
+	require.Equal(t, time.Minute*30, opts.GetMaxDuration())
+	require.Equal(t, int64(0), opts.GetMaxFileSize())
+	require.Equal(t, time.Minute*10, opts.GetStartTimeout())
+	require.Equal(t, time.Minute, opts.GetEmptyRoomGrace())
+
+	// limits can be disabled per request
+	opts, err = config.NewRequestOptions(`{"max_duration": "0s"}`)
+	require.NoError(t, err)
+	conf.ApplyRequestDefaults(opts)
+	require.Equal(t, time.Duration(0), opts.GetMaxDuration())
+
+	_, err = config.NewRequestOptions(`{"max_file_size": -1}`)
+	require.Error(t, err)
+
+	opts, err = config.NewRequestOptions(`{"upload_urls": {"room/recording.mp4": "https://bucket.s3.amazonaws.com/room/recording.mp4?X-Amz-Signature=abc"}}`)
+	require.NoError(t, err)
+	require.Len(t, opts.UploadUrls, 1)
+	_, err = config.NewRequestOptions(`{"upload_urls": {"room/recording.mp4": "s3://bucket/room/recording.mp4"}}`)
+	require.Error(t, err)
+}
+
+func TestAnalysis(t *testing.T) {
+	conf, err := config.NewConfig("defaults:\n  analysis:\n    blank: 1m")
+	require.NoError(t, err)
+
+	opts, err := config.NewRequestOptions(`{"analysis": {"silence": "5m", "action": "stop"}}`)
+	require.NoError(t, err)
+	conf.ApplyRequestDefaults(opts)
+	require.Equal(t, time.Minute, opts.Analysis.Blank)
+	require.Equal(t, time.Minute*5, opts.Analysis.Silence)
+	require.Equal(t, -60.0, opts.Analysis.SilenceLevel)
+	require.Equal(t, config.AnalysisStop, opts.Analysis.Action)
+	require.True(t, opts.Analysis.Enabled())
+
+	_, err = config.NewRequestOptions(`{"analysis": {"action": "alert"}}`)
+	require.Error(t, err)
+}
+
+func TestReadiness(t *testing.T) {
+	conf, err := config.NewConfig("defaults:\n  readiness:\n    network_idle: true")
+	require.NoError(t, err)
+
+	// defaults apply when the request sets no conditions
+	opts, err := config.NewRequestOptions(`{"readiness": {"timeout": "10s"}}`)
+	require.NoError(t, err)
+	conf.ApplyRequestDefaults(opts)
+	require.True(t, opts.Readiness.NetworkIdle)
+	require.Equal(t, time.Second*10, opts.Readiness.Timeout)
+
+	// request conditions replace the defaults
+	opts, err = config.NewRequestOptions(`{"readiness": {"selector": "#video", "delay": "2s"}}`)
+	require.NoError(t, err)
+	conf.ApplyRequestDefaults(opts)
+	require.False(t, opts.Readiness.NetworkIdle)
+	require.Equal(t, "#video", opts.Readiness.Selector)
+	require.Equal(t, time.Second*30, opts.Readiness.Timeout)
+
+	_, err = config.NewRequestOptions(`{"readiness": {"delay": "-1s"}}`)
+	require.Error(t, err)
+}
+
+func TestPage(t *testing.T) {
+	conf, err := config.NewConfig(`
+defaults:
+  page:
+    headers:
+      Authorization: Bearer default
+      X-Team: recording
+    user_agent: recorder
+    styles:
+      - ".banner { display: none }"`)
+	require.NoError(t, err)
+
+	opts, err := config.NewRequestOptions(`
+page:
+  headers:
+    Authorization: Bearer request
+  cookies:
+    - name: session
+      value: abc
+  styles:
+    - "body { overflow: hidden }"`)
+	require.NoError(t, err)
+	conf.ApplyRequestDefaults(opts)
+	require.Equal(t, "Bearer request", opts.Page.Headers["Authorization"])
+	require.Equal(t, "recording", opts.Page.Headers["X-Team"])
+	require.Equal(t, "recorder", opts.Page.UserAgent)
+	require.Len(t, opts.Page.Cookies, 1)
+	require.Len(t, opts.Page.Styles, 2)
+	require.Len(t, conf.Defaults.Page.Styles, 1)
+
+	_, err = config.NewRequestOptions("page:\n  cookies:\n    - value: abc")
+	require.Error(t, err)
+}
+
 var testRequests = []string{`
 {
 	"template": {
@@ -63,6 +192,28 @@ func TestConfig(t *testing.T) {
 	require.Equal(t, int32(320), conf.Defaults.Width)
 	require.Equal(t, int32(96), conf.Defaults.AudioBitrate)
 	require.Equal(t, config.ProfileHigh, conf.Defaults.Profile)
+	require.Equal(t, time.Second*10, conf.Timeouts.Reservation)
+	require.Equal(t, time.Second*10, conf.Timeouts.EOS)
+	require.Equal(t, time.Minute, conf.Timeouts.Shutdown)
+	require.Equal(t, config.CrashEnd, conf.OnCrash.Action)
+	require.Equal(t, 3, conf.OnCrash.MaxReloads)
+
+	require.Equal(t, config.TemplatesEmbedded, conf.Templates.Source)
+
+	_, err = config.NewConfig("on_crash:\n  action: restart")
+	require.Error(t, err)
+
+	_, err = config.NewConfig("templates:\n  source: cdn")
+	require.Error(t, err)
+
+	_, err = config.NewConfig("templates:\n  allowed_params: [token]")
+	require.Error(t, err)
+
+	require.False(t, conf.Diagnostics.Enabled)
+	_, err = config.NewConfig("diagnostics:\n  enabled: true")
+	require.Error(t, err)
+	_, err = config.NewConfig("diagnostics:\n  enabled: true\n  path: /var/log/recorder")
+	require.NoError(t, err)
 }
 
 func TestRequests(t *testing.T) {
@@ -101,3 +252,49 @@ func TestRequests(t *testing.T) {
 		require.Equal(t, config.ProfileMain, req.Options.Profile)
 	})
 }
+
+func TestChrome(t *testing.T) {
+	conf, err := config.NewConfig("chrome:\n  flags: [--lang=en-US, --disable-extensions=false, --mute-audio]\n  profiles:\n    crm: /profiles/crm\ndefaults:\n  page:\n    profile: crm")
+	require.NoError(t, err)
+	require.Equal(t, "crm", conf.Defaults.Page.Profile)
+
+	for flag, expected := range map[string]interface{}{
+		"--lang=en-US":               "en-US",
+		"--disable-extensions=false": false,
+		"--mute-audio":               true,
+	} {
+		_, value, err := config.ParseChromeFlag(flag)
+		require.NoError(t, err)
+		require.Equal(t, expected, value)
+	}
+
+	dir, err := conf.Chrome.ProfileDir("crm")
+	require.NoError(t, err)
+	require.Equal(t, "/profiles/crm", dir)
+	_, err = conf.Chrome.ProfileDir("unknown")
+	require.Error(t, err)
+
+	_, err = config.NewConfig("chrome:\n  flags: [--user-data-dir=/tmp/chrome]")
+	require.Error(t, err)
+	_, err = config.NewConfig("chrome:\n  flags: [lang=en-US]")
+	require.Error(t, err)
+	_, err = config.NewConfig("defaults:\n  page:\n    profile: unknown")
+	require.Error(t, err)
+}
+
+func TestFileOutput(t *testing.T) {
+	conf, err := config.NewConfig("")
+	require.NoError(t, err)
+	require.True(t, conf.FileOutput.Local)
+
+	conf, err = config.NewConfig("file_output:\n  directory:\n    path: /mnt/recordings")
+	require.NoError(t, err)
+	require.False(t, conf.FileOutput.Local)
+
+	_, err = config.NewConfig("file_output:\n  gcp:\n    bucket: recordings\n  directory:\n    path: /mnt/recordings")
+	require.Error(t, err)
+	_, err = config.NewConfig("file_output:\n  gateway:\n    url: https://uploads.example.com")
+	require.Error(t, err)
+	_, err = config.NewConfig("file_output:\n  sftp:\n    address: sftp.example.com:22\n    username: recorder\n    password: secret")
+	require.Error(t, err)
+}
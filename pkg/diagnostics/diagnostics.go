@@ -0,0 +1,116 @@
+package diagnostics
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLines is the number of log lines kept for each recording
+const LogLines = 1000
+
+// LogBuffer is a log sink keeping the last lines written to it
+type LogBuffer struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+func NewLogBuffer(size int) *LogBuffer {
+	return &LogBuffer{lines: make([]string, size)}
+}
+
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		b.lines[b.next] = line
+		b.next = (b.next + 1) % len(b.lines)
+		if b.next == 0 {
+			b.full = true
+		}
+	}
+	return len(p), nil
+}
+
+func (b *LogBuffer) Sync() error {
+	return nil
+}
+
+// Lines returns the buffered lines, oldest first
+func (b *LogBuffer) Lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.full {
+		return append([]string{}, b.lines[:b.next]...)
+	}
+	return append(append([]string{}, b.lines[b.next:]...), b.lines[:b.next]...)
+}
+
+// Bundle is a set of files describing a failed recording
+type Bundle struct {
+	names []string
+	files map[string][]byte
+}
+
+func NewBundle() *Bundle {
+	return &Bundle{files: make(map[string][]byte)}
+}
+
+// Add adds a file to the bundle. Empty files are skipped.
+func (b *Bundle) Add(name string, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	if _, ok := b.files[name]; !ok {
+		b.names = append(b.names, name)
+	}
+	b.files[name] = data
+}
+
+// AddLines adds a file with one line per entry
+func (b *Bundle) AddLines(name string, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	b.Add(name, []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+// Write writes the bundle as a gzipped tarball
+func (b *Bundle) Write(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	now := time.Now()
+	for _, name := range b.names {
+		data := b.files[name]
+		if err = tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: now,
+		}); err != nil {
+			break
+		}
+		if _, err = tw.Write(data); err != nil {
+			break
+		}
+	}
+
+	for _, closer := range []interface{ Close() error }{tw, gz, f} {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,80 @@
+package diagnostics
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/livekit/protocol/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogBuffer(t *testing.T) {
+	b := NewLogBuffer(3)
+	_, _ = b.Write([]byte("one\n"))
+	_, _ = b.Write([]byte("two\nthree\n"))
+	require.Equal(t, []string{"one", "two", "three"}, b.Lines())
+
+	_, _ = b.Write([]byte("four\n"))
+	require.Equal(t, []string{"two", "three", "four"}, b.Lines())
+}
+
+func TestBundle(t *testing.T) {
+	b := NewBundle()
+	b.Add("error.txt", []byte("recording failed"))
+	b.Add("screenshot.png", nil)
+	b.AddLines("recorder.log", []string{"one", "two"})
+
+	filename := path.Join(t.TempDir(), "diagnostics.tar.gz")
+	require.NoError(t, b.Write(filename))
+
+	f, err := os.Open(filename)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = string(data)
+	}
+
+	require.Equal(t, map[string]string{
+		"error.txt":    "recording failed",
+		"recorder.log": "one\ntwo\n",
+	}, files)
+}
+
+func TestLogger(t *testing.T) {
+	logger.SetLogger(funcr.New(func(prefix, args string) {}, funcr.Options{Verbosity: 1}), "test")
+
+	buf := NewLogBuffer(10)
+	l := NewLogger(buf, "recordingID", "RE_1")
+	l.Debugw("sending EOS to pipeline")
+	l.Errorw("pipeline error", errors.New("failed to start"), "element", "rtmpsink")
+
+	lines := buf.Lines()
+	require.Len(t, lines, 2)
+
+	entry := make(map[string]interface{})
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	require.Equal(t, "error", entry["level"])
+	require.Equal(t, "pipeline error", entry["msg"])
+	require.Equal(t, "RE_1", entry["recordingID"])
+	require.Equal(t, "rtmpsink", entry["element"])
+	require.Equal(t, "failed to start", entry["error"])
+}
@@ -0,0 +1,121 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/livekit/protocol/logger"
+)
+
+// NewLogger returns a logger which adds the values to each entry, and also keeps each entry in buf.
+// Everything given this logger ends up in the recording's bundle, whatever values it was logged with.
+func NewLogger(buf *LogBuffer, keysAndValues ...interface{}) logger.Logger {
+	sink := &teeSink{
+		parent: logger.GetLogger().GetSink(),
+		buf:    buf,
+	}
+	return logger.Logger(logr.New(sink).WithValues(keysAndValues...))
+}
+
+// teeSink writes entries to the process logger, and as json lines to a buffer
+type teeSink struct {
+	parent logr.LogSink
+	buf    *LogBuffer
+	name   string
+	values []interface{}
+}
+
+// Init is a no-op, since the parent has already been initialized
+func (s *teeSink) Init(logr.RuntimeInfo) {}
+
+func (s *teeSink) Enabled(level int) bool {
+	return s.parent != nil && s.parent.Enabled(level)
+}
+
+func (s *teeSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	s.parent.Info(level, msg, keysAndValues...)
+	lvl := "info"
+	if level > 0 {
+		lvl = "debug"
+	}
+	s.write(lvl, msg, nil, keysAndValues)
+}
+
+func (s *teeSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	if s.parent != nil {
+		s.parent.Error(err, msg, keysAndValues...)
+	}
+	s.write("error", msg, err, keysAndValues)
+}
+
+func (s *teeSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	res := *s
+	if s.parent != nil {
+		res.parent = s.parent.WithValues(keysAndValues...)
+	}
+	res.values = append(append([]interface{}{}, s.values...), keysAndValues...)
+	return &res
+}
+
+func (s *teeSink) WithName(name string) logr.LogSink {
+	res := *s
+	if s.parent != nil {
+		res.parent = s.parent.WithName(name)
+	}
+	if s.name != "" {
+		name = s.name + "." + name
+	}
+	res.name = name
+	return &res
+}
+
+// WithCallDepth keeps call sites pointing at the caller, past the tee
+func (s *teeSink) WithCallDepth(depth int) logr.LogSink {
+	res := *s
+	if withCallDepth, ok := s.parent.(logr.CallDepthLogSink); ok {
+		res.parent = withCallDepth.WithCallDepth(depth)
+	}
+	return &res
+}
+
+func (s *teeSink) write(level, msg string, err error, keysAndValues []interface{}) {
+	entry := map[string]interface{}{
+		"ts":    time.Now().Format(time.RFC3339Nano),
+		"level": level,
+		"msg":   msg,
+	}
+	if s.name != "" {
+		entry["logger"] = s.name
+	}
+	for _, kv := range [][]interface{}{s.values, keysAndValues} {
+		for i := 0; i+1 < len(kv); i += 2 {
+			entry[fmt.Sprint(kv[i])] = jsonValue(kv[i+1])
+		}
+	}
+	if err != nil {
+		entry["error"] = err.Error()
+	}
+
+	b, jsonErr := json.Marshal(entry)
+	if jsonErr != nil {
+		b = []byte(fmt.Sprintf("%s %s %s %v", entry["ts"], level, msg, keysAndValues))
+	}
+	_, _ = s.buf.Write(append(b, '\n'))
+}
+
+// jsonValue keeps values which encode as json, and formats anything else
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	if _, err := json.Marshal(v); err != nil {
+		return strings.TrimSpace(fmt.Sprint(v))
+	}
+	return v
+}
@@ -0,0 +1,107 @@
+package display
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	firstDisplay = 10
+	maxDisplays  = 1000
+)
+
+// allocator hands out X display numbers which are neither reserved by this process nor in use on the host
+type allocator struct {
+	mu       sync.Mutex
+	dir      string
+	reserved map[int]bool
+}
+
+var displays = newAllocator("/tmp")
+
+func newAllocator(dir string) *allocator {
+	return &allocator{
+		dir:      dir,
+		reserved: make(map[int]bool),
+	}
+}
+
+func (a *allocator) reserve() (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for n := firstDisplay; n < firstDisplay+maxDisplays; n++ {
+		if a.reserved[n] || a.inUse(n) {
+			continue
+		}
+		a.reserved[n] = true
+		return n, nil
+	}
+	return 0, ErrNoDisplayAvailable
+}
+
+func (a *allocator) release(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.reserved, n)
+}
+
+// inUse checks for an X server lock or socket. Locks left behind by dead servers are ignored, since Xvfb replaces them.
+func (a *allocator) inUse(n int) bool {
+	if b, err := os.ReadFile(a.lockFile(n)); err == nil {
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(b))); err != nil || processExists(pid) {
+			return true
+		}
+	} else if !os.IsNotExist(err) {
+		return true
+	} else if _, err = os.Stat(a.socket(n)); err == nil {
+		return true
+	}
+	return false
+}
+
+// waitForDisplay blocks until the X socket accepts connections, or the server exits
+func (a *allocator) waitForDisplay(n int, exited <-chan struct{}, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(time.Millisecond * 50)
+	defer ticker.Stop()
+
+	for {
+		if conn, err := net.Dial("unix", a.socket(n)); err == nil {
+			_ = conn.Close()
+			return nil
+		}
+
+		select {
+		case <-exited:
+			return fmt.Errorf("%w: display :%d", ErrXvfbExited, n)
+		case <-deadline:
+			return fmt.Errorf("%w: display :%d", ErrXvfbTimeout, n)
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *allocator) lockFile(n int) string {
+	return filepath.Join(a.dir, fmt.Sprintf(".X%d-lock", n))
+}
+
+func (a *allocator) socket(n int) string {
+	return filepath.Join(a.dir, ".X11-unix", fmt.Sprintf("X%d", n))
+}
+
+func processExists(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,55 @@
+package display
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocator(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".X11-unix"), 0755))
+	a := newAllocator(dir)
+
+	// live lock and existing socket are skipped
+	require.NoError(t, os.WriteFile(a.lockFile(firstDisplay), []byte(fmt.Sprintf("%10d\n", os.Getpid())), 0644))
+	require.NoError(t, os.WriteFile(a.socket(firstDisplay+1), nil, 0644))
+
+	// stale lock is reused
+	require.NoError(t, os.WriteFile(a.lockFile(firstDisplay+2), []byte("0\n"), 0644))
+
+	n, err := a.reserve()
+	require.NoError(t, err)
+	require.Equal(t, firstDisplay+2, n)
+
+	// reserved displays are skipped until released
+	m, err := a.reserve()
+	require.NoError(t, err)
+	require.Equal(t, firstDisplay+3, m)
+
+	a.release(n)
+	n, err = a.reserve()
+	require.NoError(t, err)
+	require.Equal(t, firstDisplay+2, n)
+}
+
+func TestWaitForDisplay(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".X11-unix"), 0755))
+	a := newAllocator(dir)
+
+	exited := make(chan struct{})
+	close(exited)
+	require.ErrorIs(t, a.waitForDisplay(firstDisplay, exited, time.Second), ErrXvfbExited)
+	require.ErrorIs(t, a.waitForDisplay(firstDisplay, nil, time.Millisecond*100), ErrXvfbTimeout)
+
+	l, err := net.Listen("unix", a.socket(firstDisplay))
+	require.NoError(t, err)
+	defer l.Close()
+	require.NoError(t, a.waitForDisplay(firstDisplay, nil, time.Second))
+}
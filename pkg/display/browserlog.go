@@ -0,0 +1,161 @@
+package display
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogEntry is a line of the browser log
+type LogEntry struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"` // console, exception, request_failed, or request
+	Level    string    `json:"level,omitempty"`
+	Message  string    `json:"message,omitempty"`
+	Url      string    `json:"url,omitempty"`
+	Method   string    `json:"method,omitempty"`
+	Type     string    `json:"type,omitempty"`
+	Status   int64     `json:"status,omitempty"`
+	MimeType string    `json:"mime_type,omitempty"`
+	Bytes    int64     `json:"bytes,omitempty"`
+	Duration int64     `json:"duration_ms,omitempty"`
+}
+
+// browserLog records console messages, exceptions and failed requests from a page as json lines.
+// Without a file, only the first fatal error is kept. Only the page failing to load is fatal, exceptions are logged.
+type browserLog struct {
+	mu       sync.Mutex
+	file     *os.File
+	enc      *json.Encoder
+	network  bool                 // also log successful requests
+	requests map[string]*LogEntry // in flight
+	fatal    string
+}
+
+// newBrowserLog writes to the file, if any, and removes it on close
+func newBrowserLog(file *os.File, network bool) *browserLog {
+	l := &browserLog{
+		network:  network,
+		requests: make(map[string]*LogEntry),
+	}
+	if file != nil {
+		l.file = file
+		l.enc = json.NewEncoder(file)
+	}
+	return l
+}
+
+func (l *browserLog) console(level, msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.write(&LogEntry{Time: time.Now(), Kind: "console", Level: level, Message: msg})
+}
+
+// exception logs an uncaught exception. Pages often keep working after one, so it is not fatal.
+func (l *browserLog) exception(msg, url string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.write(&LogEntry{Time: time.Now(), Kind: "exception", Message: msg, Url: RedactURL(url)})
+}
+
+func (l *browserLog) requestStarted(id, url, method, resourceType string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.requests[id] = &LogEntry{
+		Time:   time.Now(),
+		Kind:   "request",
+		Url:    RedactURL(url),
+		Method: method,
+		Type:   resourceType,
+	}
+}
+
+func (l *browserLog) responseReceived(id string, status int64, mimeType string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if req := l.requests[id]; req != nil {
+		req.Status = status
+		req.MimeType = mimeType
+	}
+}
+
+func (l *browserLog) requestFinished(id string, bytes int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	req := l.requests[id]
+	if req == nil {
+		return
+	}
+	delete(l.requests, id)
+
+	if l.network {
+		req.Bytes = bytes
+		req.Duration = time.Since(req.Time).Milliseconds()
+		l.write(req)
+	}
+}
+
+// requestFailed logs a failed request. The page failing to load is fatal.
+func (l *browserLog) requestFailed(id, errorText string, canceled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	req := l.requests[id]
+	if req == nil {
+		return
+	}
+	delete(l.requests, id)
+
+	req.Kind = "request_failed"
+	req.Message = errorText
+	req.Duration = time.Since(req.Time).Milliseconds()
+	if req.Type == "Document" && !canceled {
+		l.setFatal(fmt.Sprintf("failed to load %s: %s", req.Url, errorText))
+	}
+	l.write(req)
+}
+
+func (l *browserLog) setFatal(msg string) {
+	if l.fatal == "" {
+		l.fatal = msg
+	}
+}
+
+// fatalError returns the first fatal page error, if any
+func (l *browserLog) fatalError() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.fatal
+}
+
+// path flushes the log, returning its path
+func (l *browserLog) path() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return ""
+	}
+	_ = l.file.Sync()
+	return l.file.Name()
+}
+
+func (l *browserLog) write(entry *LogEntry) {
+	if l.enc == nil {
+		return
+	}
+	_ = l.enc.Encode(entry)
+}
+
+// close stops logging and removes the file, which must have been saved by then
+func (l *browserLog) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+	_ = l.file.Close()
+	_ = os.Remove(l.file.Name())
+	l.file = nil
+	l.enc = nil
+}
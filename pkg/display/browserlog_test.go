@@ -0,0 +1,91 @@
+package display
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBrowserLog(t *testing.T) {
+	logPath := path.Join(t.TempDir(), "browser.jsonl")
+	f, err := os.Create(logPath)
+	require.NoError(t, err)
+	l := newBrowserLog(f, false)
+
+	l.console("log", "hello")
+	l.requestStarted("1", "https://example.com/app.js?token=secret", "GET", "Script")
+	l.responseReceived("1", 200, "text/javascript")
+	l.requestFinished("1", 1024)
+	l.requestStarted("2", "https://example.com/", "GET", "Document")
+	l.requestFailed("2", "net::ERR_NAME_NOT_RESOLVED", false)
+	l.exception("Uncaught TypeError", "https://example.com/app.js")
+
+	// the failed page load is fatal, the exception is not
+	require.Equal(t, "failed to load https://example.com/: net::ERR_NAME_NOT_RESOLVED", l.fatalError())
+	require.Equal(t, logPath, l.path())
+
+	entries := readLog(t, logPath)
+	require.Len(t, entries, 3)
+	require.Equal(t, "console", entries[0].Kind)
+	require.Equal(t, "request_failed", entries[1].Kind)
+	require.Equal(t, "exception", entries[2].Kind)
+
+	l.close()
+	_, err = os.Stat(logPath)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestBrowserLogNetwork(t *testing.T) {
+	logPath := path.Join(t.TempDir(), "browser.jsonl")
+	f, err := os.Create(logPath)
+	require.NoError(t, err)
+	l := newBrowserLog(f, true)
+	defer l.close()
+
+	l.requestStarted("1", "https://example.com/app.js?token=secret", "GET", "Script")
+	l.responseReceived("1", 200, "text/javascript")
+	l.requestFinished("1", 1024)
+	l.requestStarted("2", "https://example.com/video", "GET", "Media")
+	l.requestFailed("2", "net::ERR_ABORTED", true)
+	require.Empty(t, l.fatalError())
+
+	entries := readLog(t, l.path())
+	require.Len(t, entries, 2)
+	require.Equal(t, "request", entries[0].Kind)
+	require.Equal(t, "https://example.com/app.js?token=redacted", entries[0].Url)
+	require.Equal(t, int64(200), entries[0].Status)
+	require.Equal(t, int64(1024), entries[0].Bytes)
+	require.Equal(t, "request_failed", entries[1].Kind)
+}
+
+func TestBrowserLogDisabled(t *testing.T) {
+	l := newBrowserLog(nil, false)
+	defer l.close()
+
+	l.exception("Uncaught ReferenceError", "")
+	require.Empty(t, l.fatalError())
+
+	l.requestStarted("1", "https://example.com/", "GET", "Document")
+	l.requestFailed("1", "net::ERR_CONNECTION_REFUSED", false)
+	require.Equal(t, "failed to load https://example.com/: net::ERR_CONNECTION_REFUSED", l.fatalError())
+	require.Empty(t, l.path())
+}
+
+func readLog(t *testing.T, logPath string) []*LogEntry {
+	f, err := os.Open(logPath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var entries []*LogEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry := &LogEntry{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
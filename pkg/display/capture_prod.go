@@ -0,0 +1,184 @@
+//go:build !test
+// +build !test
+
+package display
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os/exec"
+	"sync"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	"github.com/livekit/protocol/logger"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+)
+
+const (
+	screencastQuality = 90
+	frameBuffer       = 8
+)
+
+// capture gets the page's video to the pipeline
+type capture interface {
+	// start runs anything chrome needs before it launches
+	start(width, height, depth int32) error
+	// chromeOptions are added to chrome's flags
+	chromeOptions() []chromedp.ExecAllocatorOption
+	// attach starts capturing a tab. Tabs opened after a crash are attached again.
+	attach(ctx context.Context) error
+	// xDisplay is the X display for the pipeline to capture, if any
+	xDisplay() string
+	// frames receives jpeg frames for the pipeline, if there is no X display
+	frames() <-chan []byte
+	close()
+}
+
+func newCapture(conf *config.Config, log logger.Logger, displayNum int) capture {
+	if conf.Source.Capture == config.CaptureScreencast {
+		return &screencastCapture{frameChan: make(chan []byte, frameBuffer), logger: log}
+	}
+	return &x11Capture{displayNum: displayNum, display: fmt.Sprintf(":%d", displayNum), logger: log}
+}
+
+// x11Capture runs chrome on an Xvfb display, which the pipeline captures with ximagesrc
+type x11Capture struct {
+	displayNum int
+	display    string
+	xvfb       *process
+	logger     logger.Logger
+}
+
+func (c *x11Capture) start(width, height, depth int32) error {
+	dims := fmt.Sprintf("%dx%dx%d", width, height, depth)
+	c.logger.Debugw("launching xvfb", "display", c.display, "dims", dims)
+	xvfb, err := processes.start(exec.Command("Xvfb", c.display, "-screen", "0", dims, "-ac", "-nolisten", "tcp"))
+	if err != nil {
+		return err
+	}
+	c.xvfb = xvfb
+
+	// chrome fails to start without a display
+	return displays.waitForDisplay(c.displayNum, xvfb.done, xvfbStartTimeout)
+}
+
+func (c *x11Capture) chromeOptions() []chromedp.ExecAllocatorOption {
+	return []chromedp.ExecAllocatorOption{
+		chromedp.Flag("kiosk", true),
+		chromedp.Flag("display", c.display),
+	}
+}
+
+func (c *x11Capture) attach(_ context.Context) error {
+	return nil
+}
+
+func (c *x11Capture) xDisplay() string {
+	return c.display
+}
+
+func (c *x11Capture) frames() <-chan []byte {
+	return nil
+}
+
+func (c *x11Capture) close() {
+	if c.xvfb != nil {
+		processes.stop(c.xvfb, stopGracePeriod)
+		c.xvfb = nil
+	}
+}
+
+// screencastCapture runs chrome headless, and passes on the frames it sends over the devtools protocol.
+// Frames are only sent when the page changes.
+type screencastCapture struct {
+	width  int32
+	height int32
+
+	mu        sync.Mutex
+	closed    bool
+	frameChan chan []byte
+
+	logger logger.Logger
+}
+
+func (c *screencastCapture) start(width, height, _ int32) error {
+	c.width = width
+	c.height = height
+	return nil
+}
+
+func (c *screencastCapture) chromeOptions() []chromedp.ExecAllocatorOption {
+	return []chromedp.ExecAllocatorOption{
+		// the new headless mode keeps audio output, unlike the old one
+		chromedp.Flag("headless", "new"),
+		chromedp.Flag("hide-scrollbars", true),
+	}
+}
+
+func (c *screencastCapture) attach(ctx context.Context) error {
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		frame, ok := ev.(*page.EventScreencastFrame)
+		if !ok {
+			return
+		}
+
+		// chrome waits for each frame to be acknowledged before sending the next
+		go func() {
+			execCtx := cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Target)
+			if err := page.ScreencastFrameAck(frame.SessionID).Do(execCtx); err != nil {
+				c.logger.Debugw("failed to acknowledge screencast frame", "error", err)
+			}
+		}()
+
+		data, err := base64.StdEncoding.DecodeString(frame.Data)
+		if err != nil {
+			c.logger.Debugw("invalid screencast frame", "error", err)
+			return
+		}
+		c.push(data)
+	})
+
+	return chromedp.Run(ctx, page.StartScreencast().
+		WithFormat(page.ScreencastFormatJpeg).
+		WithQuality(screencastQuality).
+		WithMaxWidth(int64(c.width)).
+		WithMaxHeight(int64(c.height)).
+		WithEveryNthFrame(1),
+	)
+}
+
+// push drops frames the pipeline is not keeping up with
+func (c *screencastCapture) push(frame []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.frameChan <- frame:
+	default:
+		c.logger.Debugw("dropped screencast frame")
+	}
+}
+
+func (c *screencastCapture) xDisplay() string {
+	return ""
+}
+
+func (c *screencastCapture) frames() <-chan []byte {
+	return c.frameChan
+}
+
+// close ends the pipeline's video stream
+func (c *screencastCapture) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.frameChan)
+	}
+}
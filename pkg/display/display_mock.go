@@ -5,22 +5,23 @@ package display
 
 import (
 	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
 
 	"github.com/livekit/livekit-recorder/pkg/config"
 )
 
 type Display struct {
 	startChan chan struct{}
-	endChan   chan struct{}
+	occupancy chan bool
 }
 
-func Launch(conf *config.Config, url string, opts *livekit.RecordingOptions, isTemplate bool) (*Display, error) {
+func Launch(conf *config.Config, log logger.Logger, recordingID, url string, opts *livekit.RecordingOptions, isTemplate bool, reqOpts *config.RequestOptions) (*Display, error) {
 	startChan := make(chan struct{})
 	close(startChan)
 
 	return &Display{
 		startChan: startChan,
-		endChan:   make(chan struct{}),
+		occupancy: make(chan bool, 1),
 	}, nil
 }
 
@@ -28,10 +29,59 @@ func (d *Display) RoomStarted() chan struct{} {
 	return d.startChan
 }
 
-func (d *Display) RoomEnded() chan struct{} {
-	return d.endChan
+func (d *Display) RoomOccupied() <-chan bool {
+	return d.occupancy
+}
+
+func (d *Display) Events() <-chan *Event {
+	return nil
+}
+
+func (d *Display) Crashed() <-chan struct{} {
+	return nil
+}
+
+func (d *Display) Reload() error {
+	return nil
+}
+
+func (d *Display) Navigate(url string, readiness *config.Readiness) error {
+	return nil
+}
+
+func (d *Display) SetUrl(url string) {}
+
+func (d *Display) Evaluate(script string) ([]byte, error) {
+	return []byte("null"), nil
+}
+
+func (d *Display) Screenshot() ([]byte, error) {
+	return nil, nil
+}
+
+func (d *Display) BrowserLog() string {
+	return ""
+}
+
+func (d *Display) PageError() string {
+	return ""
+}
+
+func (d *Display) Name() string {
+	return ""
+}
+
+func (d *Display) Frames() <-chan []byte {
+	return nil
+}
+
+func (d *Display) PulseMonitor() string {
+	return ""
 }
 
 func (d *Display) Close() {
-	close(d.endChan)
+	select {
+	case d.occupancy <- false:
+	default:
+	}
 }
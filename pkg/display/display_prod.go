@@ -10,58 +10,158 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/chromedp/cdproto/inspector"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
 	"github.com/chromedp/cdproto/runtime"
 	"github.com/chromedp/chromedp"
 	"github.com/livekit/protocol/livekit"
 	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/utils"
 
 	"github.com/livekit/livekit-recorder/pkg/config"
 )
 
 const (
-	startRecording = "START_RECORDING"
-	endRecording   = "END_RECORDING"
+	xvfbStartTimeout  = time.Second * 10
+	reloadTimeout     = time.Second * 30
+	screenshotTimeout = time.Second * 5
 )
 
 type Display struct {
-	xvfb         *exec.Cmd
+	logger       logger.Logger
+	recordingID  string
+	displayNum   int // 0 without an X display
+	capture      capture
+	chrome       *process
 	chromeCancel context.CancelFunc
-	startChan    chan struct{}
-	endChan      chan struct{}
+	pulseSink    string
+	pulseModule  string
+	dataDir      *userDataDir
+
+	// tab being recorded, replaced if it has to be reopened. ctx and chromeCancel are guarded by mu.
+	ctx  context.Context
+	url  string
+	page *config.Page
+
+	mu        sync.Mutex
+	closed    bool
+	startChan chan struct{}
+	roomEmpty bool
+	occupancy chan bool
+	crashChan chan struct{}
+	events    chan *Event
+	log       *browserLog
+
+	// readiness signals for url inputs
+	readyMessage string
+	readyChan    chan struct{}
+	idleChan     chan struct{}
+	watchingIdle bool
 }
 
-func Launch(conf *config.Config, url string, opts *livekit.RecordingOptions, isTemplate bool) (*Display, error) {
+// Launch opens the url, on a new X display unless it is screencast. Url inputs wait for the page to meet the readiness conditions, if any.
+func Launch(conf *config.Config, log logger.Logger, recordingID, url string, opts *livekit.RecordingOptions, isTemplate bool, reqOpts *config.RequestOptions) (*Display, error) {
+	// screencasts run chrome headless, without an X display
+	var n int
+	var err error
+	if conf.Source.Capture != config.CaptureScreencast {
+		if n, err = displays.reserve(); err != nil {
+			return nil, err
+		}
+	}
+
 	d := &Display{
-		startChan: make(chan struct{}),
-		endChan:   make(chan struct{}),
+		logger:      log,
+		recordingID: recordingID,
+		displayNum:  n,
+		capture:     newCapture(conf, log, n),
+		url:         url,
+		startChan:   make(chan struct{}),
+		occupancy:   make(chan bool, 8),
+		crashChan:   make(chan struct{}, 1),
+		events:      make(chan *Event, 32),
+		readyChan:   make(chan struct{}),
+		idleChan:    make(chan struct{}),
+	}
+
+	var logFile *os.File
+	if conf.BrowserLog.Enabled {
+		if logFile, err = os.CreateTemp("", fmt.Sprintf("livekit-recorder-browser-%s-*.jsonl", recordingID)); err != nil {
+			d.releaseDisplay()
+			return nil, err
+		}
+	}
+	d.log = newBrowserLog(logFile, conf.BrowserLog.Network)
+
+	var readiness *config.Readiness
+	if reqOpts != nil {
+		readiness = &reqOpts.Readiness
+		d.readyMessage = readiness.ConsoleMessage
+		d.page = &reqOpts.Page
 	}
 
-	if err := d.launchXvfb(conf.Display, opts.Width, opts.Height, opts.Depth); err != nil {
+	if err = d.launchPulseSink(); err != nil {
+		d.log.close()
+		d.releaseDisplay()
 		return nil, err
 	}
-	if err := d.launchChrome(conf, url, opts.Width, opts.Height, isTemplate); err != nil {
+	if err = d.capture.start(opts.Width, opts.Height, opts.Depth); err != nil {
+		d.Close()
 		return nil, err
 	}
+	if err = d.launchChrome(conf, url, opts.Width, opts.Height, isTemplate); err != nil {
+		d.Close()
+		return nil, err
+	}
+	if !isTemplate && readiness != nil && readiness.Enabled() {
+		if err = d.waitUntilReady(readiness); err != nil {
+			d.Close()
+			return nil, err
+		}
+	}
 
 	return d, nil
 }
 
-func (d *Display) launchXvfb(display string, width, height, depth int32) error {
-	dims := fmt.Sprintf("%dx%dx%d", width, height, depth)
-	logger.Debugw("launching xvfb", "dims", dims)
-	xvfb := exec.Command("Xvfb", display, "-screen", "0", dims, "-ac", "-nolisten", "tcp")
-	if err := xvfb.Start(); err != nil {
-		return err
+// launchPulseSink creates a null sink for this recording, so audio from other recordings on the host can't leak in
+func (d *Display) launchPulseSink() error {
+	sink := utils.NewGuid("recorder_")
+	d.logger.Debugw("creating pulse sink", "sink", sink)
+	out, err := exec.Command("pactl", "load-module", "module-null-sink",
+		fmt.Sprintf("sink_name=%s", sink),
+		fmt.Sprintf("sink_properties=device.description=%s", sink),
+	).Output()
+	if err != nil {
+		return fmt.Errorf("failed to create pulse sink: %v", err)
 	}
-	d.xvfb = xvfb
+
+	d.pulseSink = sink
+	d.pulseModule = strings.TrimSpace(string(out))
 	return nil
 }
 
 func (d *Display) launchChrome(conf *config.Config, url string, width, height int32, isTemplate bool) error {
-	logger.Debugw("launching chrome", "url", url)
+	d.logger.Debugw("launching chrome", "url", RedactURL(url))
+
+	var profile string
+	if d.page != nil {
+		profile = d.page.Profile
+	}
+	profileDir, err := conf.Chrome.ProfileDir(profile)
+	if err != nil {
+		return err
+	}
+	if d.dataDir, err = newUserDataDir(d.recordingID, profileDir); err != nil {
+		return err
+	}
 
+	var chromePath string
 	opts := []chromedp.ExecAllocatorOption{
 		chromedp.NoFirstRun,
 		chromedp.NoDefaultBrowserCheck,
@@ -94,12 +194,26 @@ func (d *Display) launchChrome(conf *config.Config, url string, width, height in
 		chromedp.Flag("use-mock-keychain", true),
 
 		// custom args
-		chromedp.Flag("kiosk", true),
 		chromedp.Flag("enable-automation", false),
 		chromedp.Flag("autoplay-policy", "no-user-gesture-required"),
 		chromedp.Flag("window-position", "0,0"),
 		chromedp.Flag("window-size", fmt.Sprintf("%d,%d", width, height)),
-		chromedp.Flag("display", conf.Display),
+
+		chromedp.UserDataDir(d.dataDir.path),
+
+		// send audio to this recording's sink
+		chromedp.Env(fmt.Sprintf("PULSE_SINK=%s", d.pulseSink)),
+
+		chromedp.ModifyCmdFunc(func(cmd *exec.Cmd) {
+			supervise(cmd)
+			chromePath = cmd.Path
+			d.logger.Debugw("chrome flags", "path", cmd.Path, "flags", redactFlags(cmd.Args[1:]))
+		}),
+	}
+
+	opts = append(opts, d.capture.chromeOptions()...)
+	if conf.Chrome.Path != "" {
+		opts = append(opts, chromedp.ExecPath(conf.Chrome.Path))
 	}
 
 	if conf.Insecure {
@@ -109,35 +223,46 @@ func (d *Display) launchChrome(conf *config.Config, url string, width, height in
 		)
 	}
 
-	allocCtx, _ := chromedp.NewExecAllocator(context.Background(), opts...)
+	// configured flags override the defaults
+	for _, flag := range conf.Chrome.Flags {
+		name, value, err := config.ParseChromeFlag(flag)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, chromedp.Flag(name, value))
+	}
+
+	allocCtx, allocCancel := chromedp.NewExecAllocator(context.Background(), opts...)
 	ctx, cancel := chromedp.NewContext(allocCtx)
-	d.chromeCancel = cancel
+	d.mu.Lock()
+	d.chromeCancel = func() {
+		cancel()
+		allocCancel()
+	}
+	d.ctx = ctx
+	d.mu.Unlock()
+	d.listen(ctx)
 
-	chromedp.ListenTarget(ctx, func(ev interface{}) {
-		switch ev := ev.(type) {
-		case *runtime.EventConsoleAPICalled:
-			args := make([]string, 0, len(ev.Args))
-			for _, arg := range ev.Args {
-				var val interface{}
-				err := json.Unmarshal(arg.Value, &val)
-				if err != nil {
-					continue
-				}
-				msg := fmt.Sprint(val)
-				args = append(args, msg)
-				switch msg {
-				case startRecording:
-					close(d.startChan)
-				case endRecording:
-					close(d.endChan)
-				default:
-				}
-			}
-			logger.Debugw(fmt.Sprintf("chrome console %s", ev.Type.String()), "msg", strings.Join(args, " "))
-		}
-	})
+	// start the browser
+	if err := chromedp.Run(ctx); err != nil {
+		return err
+	}
+	if browser := chromedp.FromContext(ctx).Browser.Process(); browser != nil {
+		done := make(chan struct{})
+		go func() {
+			chromedp.FromContext(ctx).Allocator.Wait()
+			close(done)
+		}()
+		d.chrome = processes.track(filepath.Base(chromePath), browser.Pid, done)
+	}
+
+	if err = d.preparePage(ctx); err != nil {
+		return err
+	}
+	if err = d.capture.attach(ctx); err != nil {
+		return err
+	}
 
-	var err error
 	var errString string
 	if isTemplate {
 		err = chromedp.Run(ctx,
@@ -151,6 +276,10 @@ func (d *Display) launchChrome(conf *config.Config, url string, width, height in
 			),
 		)
 	} else {
+		// ignore the blank page chrome starts with
+		d.mu.Lock()
+		d.watchingIdle = true
+		d.mu.Unlock()
 		err = chromedp.Run(ctx, chromedp.Navigate(url))
 	}
 	if err == nil && errString != "" {
@@ -159,25 +288,390 @@ func (d *Display) launchChrome(conf *config.Config, url string, width, height in
 	return err
 }
 
+// listen handles console messages and crashes from a tab
+func (d *Display) listen(ctx context.Context) {
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		switch ev := ev.(type) {
+		case *runtime.EventConsoleAPICalled:
+			args := make([]string, 0, len(ev.Args))
+			for _, arg := range ev.Args {
+				var val interface{}
+				err := json.Unmarshal(arg.Value, &val)
+				if err != nil {
+					continue
+				}
+				msg := fmt.Sprint(val)
+				args = append(args, msg)
+				if event, ok := parseEvent(msg); ok {
+					d.handleEvent(event)
+				} else {
+					d.consoleReady(msg)
+				}
+			}
+			d.logger.Debugw(fmt.Sprintf("chrome console %s", ev.Type.String()), "msg", strings.Join(args, " "))
+			d.log.console(ev.Type.String(), strings.Join(args, " "))
+		case *runtime.EventExceptionThrown:
+			details := ev.ExceptionDetails
+			d.logger.Infow("page exception", "error", details.Error())
+			d.log.exception(details.Error(), details.URL)
+		case *network.EventRequestWillBeSent:
+			d.log.requestStarted(ev.RequestID.String(), ev.Request.URL, ev.Request.Method, ev.Type.String())
+		case *network.EventResponseReceived:
+			d.log.responseReceived(ev.RequestID.String(), ev.Response.Status, ev.Response.MimeType)
+		case *network.EventLoadingFinished:
+			d.log.requestFinished(ev.RequestID.String(), int64(ev.EncodedDataLength))
+		case *network.EventLoadingFailed:
+			d.log.requestFailed(ev.RequestID.String(), ev.ErrorText, ev.Canceled)
+		case *runtime.EventBindingCalled:
+			if ev.Name != eventBinding {
+				break
+			}
+			if event, ok := parseEvent(ev.Payload); ok {
+				d.handleEvent(event)
+			} else {
+				d.logger.Infow("invalid page event", "payload", ev.Payload)
+			}
+		case *page.EventLifecycleEvent:
+			if ev.Name == "networkIdle" {
+				d.networkIdle()
+			}
+		case *inspector.EventTargetCrashed:
+			d.crashed("target crashed")
+		case *inspector.EventDetached:
+			d.crashed(ev.Reason.String())
+		}
+	})
+}
+
+// signal closes a channel once. A reloaded template logs its messages again.
+func (d *Display) signal(c chan struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	closeOnce(c)
+}
+
+func closeOnce(c chan struct{}) {
+	select {
+	case <-c:
+	default:
+		close(c)
+	}
+}
+
+func (d *Display) consoleReady(msg string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.readyMessage != "" && msg == d.readyMessage {
+		closeOnce(d.readyChan)
+	}
+}
+
+func (d *Display) networkIdle() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.watchingIdle {
+		closeOnce(d.idleChan)
+	}
+}
+
+// resetReadiness watches for the conditions of a page which is about to be loaded
+func (d *Display) resetReadiness(readiness *config.Readiness) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.readyMessage = ""
+	if readiness != nil {
+		d.readyMessage = readiness.ConsoleMessage
+	}
+	d.readyChan = make(chan struct{})
+	d.idleChan = make(chan struct{})
+	d.watchingIdle = true
+}
+
+// handleEvent tracks the room state, and passes every event on to the recorder
+func (d *Display) handleEvent(ev *Event) {
+	switch ev.Event {
+	case EventStart:
+		d.signal(d.startChan)
+		d.setOccupied(true)
+	case EventEnd:
+		d.setOccupied(false)
+	}
+
+	select {
+	case d.events <- ev:
+	default:
+		d.logger.Infow("dropped page event", "event", ev.Event)
+	}
+}
+
+// setOccupied reports the room emptying, or a participant joining an empty room
+func (d *Display) setOccupied(occupied bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.roomEmpty == !occupied {
+		return
+	}
+	d.roomEmpty = !occupied
+	select {
+	case d.occupancy <- occupied:
+	default:
+		d.logger.Infow("dropped room occupancy update", "occupied", occupied)
+	}
+}
+
+// waitUntilReady blocks until every readiness condition is met, or the timeout expires
+func (d *Display) waitUntilReady(readiness *config.Readiness) error {
+	ctx := d.tab()
+	if readiness.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, readiness.Timeout)
+		defer cancel()
+	}
+
+	notReady := func(condition string) error {
+		return fmt.Errorf("%w %s", ErrPageNotReady, condition)
+	}
+	wait := func(c <-chan struct{}) bool {
+		select {
+		case <-c:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	d.mu.Lock()
+	readyChan, idleChan := d.readyChan, d.idleChan
+	d.mu.Unlock()
+
+	d.logger.Debugw("waiting for page", "url", RedactURL(d.getUrl()))
+	if readiness.Selector != "" {
+		if err := chromedp.Run(ctx, chromedp.WaitVisible(readiness.Selector, chromedp.ByQuery)); err != nil {
+			return notReady(fmt.Sprintf("selector %q", readiness.Selector))
+		}
+	}
+	if readiness.NetworkIdle && !wait(idleChan) {
+		return notReady("network idle")
+	}
+	if readiness.Predicate != "" {
+		var res bool
+		if err := chromedp.Run(ctx, chromedp.Poll(readiness.Predicate, &res)); err != nil {
+			return notReady(fmt.Sprintf("predicate %q", readiness.Predicate))
+		}
+	}
+	if readiness.ConsoleMessage != "" && !wait(readyChan) {
+		return notReady(fmt.Sprintf("console message %q", readiness.ConsoleMessage))
+	}
+	if readiness.Delay > 0 {
+		select {
+		case <-time.After(readiness.Delay):
+		case <-ctx.Done():
+			return notReady("delay")
+		}
+	}
+
+	d.logger.Debugw("page ready", "url", RedactURL(d.getUrl()))
+	return nil
+}
+
+func (d *Display) crashed(reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+
+	d.logger.Infow("page crashed", "reason", reason, "url", RedactURL(d.url))
+	select {
+	case d.crashChan <- struct{}{}:
+	default:
+	}
+}
+
+// Reload navigates to the page again after a crash, opening a new tab if the old one is gone
+func (d *Display) Reload() error {
+	url := d.getUrl()
+	d.logger.Infow("reloading page", "url", RedactURL(url))
+	if err := navigate(d.tab(), url); err == nil {
+		return nil
+	}
+
+	ctx, cancel := chromedp.NewContext(d.tab())
+	d.listen(ctx)
+	if err := d.preparePage(ctx); err != nil {
+		cancel()
+		return err
+	}
+	if err := d.capture.attach(ctx); err != nil {
+		cancel()
+		return err
+	}
+	if err := navigate(ctx, url); err != nil {
+		cancel()
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		cancel()
+		return ErrDisplayClosed
+	}
+	closeBrowser := d.chromeCancel
+	d.chromeCancel = func() {
+		cancel()
+		closeBrowser()
+	}
+	d.ctx = ctx
+	return nil
+}
+
+// tab returns the context of the tab being recorded
+func (d *Display) tab() context.Context {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.ctx
+}
+
+// Navigate loads another url in the same tab, which is also used for later reloads.
+// The readiness conditions, if any, are waited for once it loads.
+func (d *Display) Navigate(url string, readiness *config.Readiness) error {
+	d.logger.Infow("navigating page", "url", RedactURL(url))
+	d.resetReadiness(readiness)
+	if err := navigate(d.tab(), url); err != nil {
+		return err
+	}
+	d.SetUrl(url)
+
+	if readiness != nil && readiness.Enabled() {
+		return d.waitUntilReady(readiness)
+	}
+	return nil
+}
+
+// Screenshot captures the page as a png
+func (d *Display) Screenshot() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(d.tab(), screenshotTimeout)
+	defer cancel()
+
+	var buf []byte
+	err := chromedp.Run(ctx, chromedp.CaptureScreenshot(&buf))
+	return buf, err
+}
+
+// SetUrl changes the url used for reloads, without navigating
+func (d *Display) SetUrl(url string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.url = url
+}
+
+func (d *Display) getUrl() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.url
+}
+
+// Evaluate runs a script in the page, returning its json encoded result. Promises are awaited.
+func (d *Display) Evaluate(script string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(d.tab(), reloadTimeout)
+	defer cancel()
+
+	var res []byte
+	err := chromedp.Run(ctx, chromedp.Evaluate(script, &res, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+		return p.WithAwaitPromise(true)
+	}))
+	return res, err
+}
+
+func navigate(ctx context.Context, url string) error {
+	ctx, cancel := context.WithTimeout(ctx, reloadTimeout)
+	defer cancel()
+	return chromedp.Run(ctx, chromedp.Navigate(url))
+}
+
 func (d *Display) RoomStarted() chan struct{} {
 	return d.startChan
 }
 
-func (d *Display) RoomEnded() chan struct{} {
-	return d.endChan
+// RoomOccupied receives false when the last participant leaves, and true when someone joins the empty room
+func (d *Display) RoomOccupied() <-chan bool {
+	return d.occupancy
+}
+
+// Events receives messages sent by the page
+func (d *Display) Events() <-chan *Event {
+	return d.events
+}
+
+// Crashed receives when the page crashes or its tab is closed
+func (d *Display) Crashed() <-chan struct{} {
+	return d.crashChan
+}
+
+// BrowserLog flushes the browser log, returning its path. It is removed when the display closes.
+func (d *Display) BrowserLog() string {
+	return d.log.path()
+}
+
+// PageError returns the first fatal page error, which is the page failing to load
+func (d *Display) PageError() string {
+	return d.log.fatalError()
+}
+
+// Name returns the X display, e.g. ":99", or nothing if the page is captured by screencast
+func (d *Display) Name() string {
+	return d.capture.xDisplay()
+}
+
+// Frames receives jpeg frames of the page when it is captured by screencast, and is closed with the display
+func (d *Display) Frames() <-chan []byte {
+	return d.capture.frames()
+}
+
+// PulseMonitor returns the pulse source capturing this recording's audio
+func (d *Display) PulseMonitor() string {
+	return d.pulseSink + ".monitor"
+}
+
+// releaseDisplay returns the X display, if any, to the allocator
+func (d *Display) releaseDisplay() {
+	if d.displayNum != 0 {
+		displays.release(d.displayNum)
+		d.displayNum = 0
+	}
 }
 
 func (d *Display) Close() {
-	if d.chromeCancel != nil {
-		d.chromeCancel()
-		d.chromeCancel = nil
+	d.mu.Lock()
+	d.closed = true
+	chromeCancel := d.chromeCancel
+	d.chromeCancel = nil
+	d.mu.Unlock()
+
+	if d.chrome != nil {
+		processes.stop(d.chrome, stopGracePeriod)
+		d.chrome = nil
+	}
+	if chromeCancel != nil {
+		chromeCancel()
+	}
+	if d.dataDir != nil {
+		d.dataDir.close()
+		d.dataDir = nil
 	}
 
-	if d.xvfb != nil {
-		err := d.xvfb.Process.Signal(os.Interrupt)
-		if err != nil {
-			logger.Errorw("failed to kill xvfb", err)
+	d.capture.close()
+	d.releaseDisplay()
+
+	if d.pulseModule != "" {
+		if err := exec.Command("pactl", "unload-module", d.pulseModule).Run(); err != nil {
+			d.logger.Errorw("failed to unload pulse sink", err, "sink", d.pulseSink)
 		}
-		d.xvfb = nil
+		d.pulseModule = ""
 	}
+
+	d.log.close()
 }
@@ -0,0 +1,15 @@
+package display
+
+import (
+	"errors"
+)
+
+var (
+	ErrNoDisplayAvailable = errors.New("no display available")
+	ErrXvfbExited         = errors.New("xvfb exited before accepting connections")
+	ErrXvfbTimeout        = errors.New("timed out waiting for xvfb")
+	ErrPageNotReady       = errors.New("page not ready: timed out waiting for")
+	ErrProfileInUse       = errors.New("chrome profile in use by another recording")
+	ErrDisplayClosed      = errors.New("display closed")
+	ErrNoPageOrigin       = errors.New("page headers and basic auth need an absolute http(s) page url")
+)
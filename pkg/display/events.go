@@ -0,0 +1,76 @@
+package display
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Pages send events either by logging them to the console, or by calling the binding with a json string:
+//
+//	window.livekitRecorder(JSON.stringify({type: 'recorder', event: 'marker', label: 'Q&A'}))
+const (
+	eventBinding = "livekitRecorder"
+	eventType    = "recorder"
+
+	startRecording = "START_RECORDING"
+	endRecording   = "END_RECORDING"
+)
+
+type EventType string
+
+const (
+	EventStart  EventType = "start"
+	EventEnd    EventType = "end"
+	EventMarker EventType = "marker"
+	EventPause  EventType = "pause" // pause and resume only annotate the metadata, capture continues
+	EventResume EventType = "resume"
+	EventLayout EventType = "layout"
+	EventError  EventType = "error"
+)
+
+var validEvents = map[EventType]bool{
+	EventStart:  true,
+	EventEnd:    true,
+	EventMarker: true,
+	EventPause:  true,
+	EventResume: true,
+	EventLayout: true,
+	EventError:  true,
+}
+
+// Event is a message from the recorded page
+type Event struct {
+	Event  EventType `json:"event"`
+	Label  string    `json:"label,omitempty"`
+	Layout string    `json:"layout,omitempty"`
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// parseEvent reads a json event, or one of the legacy START_RECORDING and END_RECORDING messages
+func parseEvent(msg string) (*Event, bool) {
+	switch msg {
+	case startRecording:
+		return &Event{Event: EventStart, Time: time.Now()}, true
+	case endRecording:
+		return &Event{Event: EventEnd, Time: time.Now()}, true
+	}
+
+	msg = strings.TrimSpace(msg)
+	if !strings.HasPrefix(msg, "{") {
+		return nil, false
+	}
+
+	var raw struct {
+		Type string `json:"type"`
+		Event
+	}
+	if err := json.Unmarshal([]byte(msg), &raw); err != nil || raw.Type != eventType || !validEvents[raw.Event.Event] {
+		return nil, false
+	}
+
+	ev := raw.Event
+	ev.Time = time.Now()
+	return &ev, true
+}
@@ -0,0 +1,33 @@
+package display
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEvent(t *testing.T) {
+	ev, ok := parseEvent("START_RECORDING")
+	require.True(t, ok)
+	require.Equal(t, EventStart, ev.Event)
+
+	ev, ok = parseEvent(`{"type":"recorder","event":"marker","label":"Q&A"}`)
+	require.True(t, ok)
+	require.Equal(t, EventMarker, ev.Event)
+	require.Equal(t, "Q&A", ev.Label)
+	require.False(t, ev.Time.IsZero())
+
+	ev, ok = parseEvent(`{"type":"recorder","event":"layout","layout":"grid-dark"}`)
+	require.True(t, ok)
+	require.Equal(t, "grid-dark", ev.Layout)
+
+	for _, msg := range []string{
+		"hello",
+		`{"type":"analytics","event":"marker"}`,
+		`{"type":"recorder","event":"rewind"}`,
+		`{"type":"recorder"`,
+	} {
+		_, ok = parseEvent(msg)
+		require.False(t, ok, msg)
+	}
+}
@@ -0,0 +1,60 @@
+package display
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// pageOrigin returns the scheme and host of a page url, as chrome formats them in request urls
+func pageOrigin(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "", ErrNoPageOrigin
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if _, ok := defaultPorts[scheme]; !ok {
+		return "", ErrNoPageOrigin
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" && port != defaultPorts[scheme] {
+		host = fmt.Sprintf("%s:%s", host, port)
+	}
+	return scheme + "://" + host, nil
+}
+
+// sameOrigin returns true if the request url belongs to the origin
+func sameOrigin(origin, raw string) bool {
+	o, err := pageOrigin(raw)
+	return err == nil && o == origin
+}
+
+// withHeaders adds the extra headers to a request's own, replacing any with the same name
+func withHeaders(req network.Headers, extra map[string]string) []*fetch.HeaderEntry {
+	headers := make([]*fetch.HeaderEntry, 0, len(req)+len(extra))
+	replaced := make(map[string]bool, len(extra))
+	for name := range extra {
+		replaced[strings.ToLower(name)] = true
+	}
+	for name, value := range req {
+		if !replaced[strings.ToLower(name)] {
+			headers = append(headers, &fetch.HeaderEntry{Name: name, Value: fmt.Sprint(value)})
+		}
+	}
+	for name, value := range extra {
+		headers = append(headers, &fetch.HeaderEntry{Name: name, Value: value})
+	}
+	return headers
+}
@@ -0,0 +1,46 @@
+package display
+
+import (
+	"testing"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPageOrigin(t *testing.T) {
+	for raw, expected := range map[string]string{
+		"https://Example.com/dashboard?page=2": "https://example.com",
+		"https://example.com:443/":             "https://example.com",
+		"http://localhost:8080/#/speaker-dark": "http://localhost:8080",
+	} {
+		origin, err := pageOrigin(raw)
+		require.NoError(t, err)
+		require.Equal(t, expected, origin)
+	}
+
+	for _, raw := range []string{"example.com/dashboard", "file:///etc/hosts"} {
+		_, err := pageOrigin(raw)
+		require.ErrorIs(t, err, ErrNoPageOrigin)
+	}
+
+	require.True(t, sameOrigin("https://example.com", "https://example.com/api/data"))
+	require.False(t, sameOrigin("https://example.com", "https://example.com.evil.io/"))
+	require.False(t, sameOrigin("https://example.com", "http://example.com/"))
+	require.False(t, sameOrigin("https://example.com", "https://cdn.example.com/app.js"))
+}
+
+func TestWithHeaders(t *testing.T) {
+	headers := withHeaders(network.Headers{
+		"Accept":        "text/html",
+		"authorization": "Bearer old",
+	}, map[string]string{"Authorization": "Bearer new"})
+
+	actual := make(map[string]string)
+	for _, h := range headers {
+		actual[h.Name] = h.Value
+	}
+	require.Equal(t, map[string]string{
+		"Accept":        "text/html",
+		"Authorization": "Bearer new",
+	}, actual)
+}
@@ -0,0 +1,160 @@
+//go:build !test
+// +build !test
+
+package display
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+	"github.com/livekit/protocol/logger"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+)
+
+// preparePage adds the event binding, and applies page options to a tab. Must be called before navigating.
+func (d *Display) preparePage(ctx context.Context) error {
+	actions := []chromedp.Action{runtime.AddBinding(eventBinding)}
+
+	p := d.page
+	if p == nil {
+		return chromedp.Run(ctx, actions...)
+	}
+
+	// only names are logged, values may be secrets
+	headers := make([]string, 0, len(p.Headers))
+	for name := range p.Headers {
+		headers = append(headers, name)
+	}
+	cookies := make([]string, 0, len(p.Cookies))
+	for _, c := range p.Cookies {
+		cookies = append(cookies, c.Name)
+	}
+	d.logger.Debugw("preparing page",
+		"headers", headers,
+		"cookies", cookies,
+		"basicAuth", p.BasicAuth != nil,
+		"userAgent", p.UserAgent,
+		"scripts", len(p.Scripts),
+		"styles", len(p.Styles),
+	)
+
+	if p.UserAgent != "" {
+		actions = append(actions, emulation.SetUserAgentOverride(p.UserAgent))
+	}
+	for _, c := range p.Cookies {
+		setCookie := network.SetCookie(c.Name, c.Value).
+			WithSecure(c.Secure).
+			WithHTTPOnly(c.HTTPOnly)
+		if c.Domain != "" {
+			setCookie = setCookie.WithDomain(c.Domain)
+		} else {
+			setCookie = setCookie.WithURL(d.url)
+		}
+		if c.Path != "" {
+			setCookie = setCookie.WithPath(c.Path)
+		}
+		actions = append(actions, setCookie)
+	}
+	for _, script := range p.Scripts {
+		actions = append(actions, addScript(script))
+	}
+	for _, css := range p.Styles {
+		actions = append(actions, addScript(styleScript(css)))
+	}
+	if len(p.Headers) > 0 || p.BasicAuth != nil {
+		// only requests to the page's origin are paused, so headers and credentials are never sent anywhere else
+		origin, err := pageOrigin(d.url)
+		if err != nil {
+			return err
+		}
+		interceptRequests(ctx, d.logger, origin, p.Headers, p.BasicAuth)
+		enable := fetch.Enable().WithPatterns([]*fetch.RequestPattern{{URLPattern: origin + "/*"}})
+		if p.BasicAuth != nil {
+			enable = enable.WithHandleAuthRequests(true)
+		}
+		actions = append(actions, enable)
+	}
+
+	if err := chromedp.Run(ctx, actions...); err != nil {
+		return fmt.Errorf("failed to prepare page: %w", err)
+	}
+	return nil
+}
+
+func addScript(source string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		_, err := page.AddScriptToEvaluateOnNewDocument(source).Do(ctx)
+		return err
+	})
+}
+
+// styleScript adds a stylesheet once the document has a head
+func styleScript(css string) string {
+	b, _ := json.Marshal(css)
+	return fmt.Sprintf(`(() => {
+	const add = () => {
+		const style = document.createElement('style');
+		style.textContent = %s;
+		(document.head || document.documentElement).appendChild(style);
+	};
+	if (document.readyState === 'loading') {
+		document.addEventListener('DOMContentLoaded', add);
+	} else {
+		add();
+	}
+})();`, b)
+}
+
+// interceptRequests adds headers to paused requests, and answers basic auth challenges. Paused requests must all be
+// continued. Requests are checked against the origin again, in case chrome matched the pattern more loosely.
+// Credentials are only offered once per request, so a wrong password fails instead of retrying forever.
+func interceptRequests(ctx context.Context, log logger.Logger, origin string, headers map[string]string, auth *config.BasicAuth) {
+	var challenged sync.Map
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		switch ev := ev.(type) {
+		case *fetch.EventRequestPaused:
+			go func() {
+				req := fetch.ContinueRequest(ev.RequestID)
+				if len(headers) > 0 && sameOrigin(origin, ev.Request.URL) {
+					req = req.WithHeaders(withHeaders(ev.Request.Headers, headers))
+				}
+				execCtx := cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Target)
+				if err := req.Do(execCtx); err != nil {
+					log.Debugw("failed to continue request", "error", err)
+				}
+			}()
+		case *fetch.EventAuthRequired:
+			go func() {
+				res := &fetch.AuthChallengeResponse{Response: fetch.AuthChallengeResponseResponseCancelAuth}
+				challenge := ev.AuthChallenge
+				if auth == nil || challenge == nil || challenge.Source == fetch.AuthChallengeSourceProxy ||
+					!sameOrigin(origin, challenge.Origin) {
+					log.Infow("basic auth not offered", "url", RedactURL(ev.Request.URL))
+				} else if _, retry := challenged.LoadOrStore(ev.RequestID, true); !retry {
+					res = &fetch.AuthChallengeResponse{
+						Response: fetch.AuthChallengeResponseResponseProvideCredentials,
+						Username: auth.Username,
+						Password: auth.Password,
+					}
+				} else {
+					log.Infow("basic auth rejected", "url", RedactURL(ev.Request.URL))
+				}
+
+				execCtx := cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Target)
+				if err := fetch.ContinueWithAuth(ev.RequestID, res).Do(execCtx); err != nil {
+					log.Debugw("failed to continue auth", "error", err)
+				}
+			}()
+		}
+	})
+}
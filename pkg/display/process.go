@@ -0,0 +1,241 @@
+package display
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+)
+
+const stopGracePeriod = time.Second * 5
+
+// processes tracks every child started by a display. Each child leads its own process group, so stopping it also
+// stops anything it spawned. A pid file is kept for each child, so a later instance can clean up after a crash.
+// Pdeathsig is not used, since it fires when the forking thread exits rather than the recorder.
+var processes = newProcessRegistry(filepath.Join(os.TempDir(), "livekit-recorder"))
+
+type processRegistry struct {
+	mu    sync.Mutex
+	dir   string
+	procs map[int]*process
+}
+
+type process struct {
+	name string
+	pid  int
+	done <-chan struct{}
+}
+
+func newProcessRegistry(dir string) *processRegistry {
+	return &processRegistry{
+		dir:   dir,
+		procs: make(map[int]*process),
+	}
+}
+
+// supervise puts the command in its own process group
+func supervise(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// start runs and tracks the command
+func (r *processRegistry) start(cmd *exec.Cmd) (*process, error) {
+	supervise(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(done)
+	}()
+
+	return r.track(filepath.Base(cmd.Path), cmd.Process.Pid, done), nil
+}
+
+// track registers a supervised process started elsewhere. done should be closed once the process has been reaped.
+func (r *processRegistry) track(name string, pid int, done <-chan struct{}) *process {
+	p := &process{
+		name: name,
+		pid:  pid,
+		done: done,
+	}
+
+	if err := os.MkdirAll(r.dir, 0755); err == nil {
+		err = os.WriteFile(r.pidFile(pid), []byte(fmt.Sprintf("%d %d %s\n", os.Getpid(), selfStartTime(), name)), 0644)
+		if err != nil {
+			logger.Errorw("failed to write pid file", err, "process", name)
+		}
+	}
+
+	r.mu.Lock()
+	r.procs[pid] = p
+	r.mu.Unlock()
+	return p
+}
+
+// stop sends SIGTERM to the process group, then SIGKILL to anything left once the leader exits or the grace period ends
+func (r *processRegistry) stop(p *process, grace time.Duration) {
+	r.mu.Lock()
+	_, ok := r.procs[p.pid]
+	delete(r.procs, p.pid)
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	logger.Debugw("stopping process", "process", p.name, "pid", p.pid)
+	if err := syscall.Kill(-p.pid, syscall.SIGTERM); err == nil {
+		select {
+		case <-p.done:
+		case <-time.After(grace):
+			logger.Infow("process did not exit, killing", "process", p.name, "pid", p.pid)
+		}
+	}
+	_ = syscall.Kill(-p.pid, syscall.SIGKILL)
+
+	_ = os.Remove(r.pidFile(p.pid))
+}
+
+// stopAll stops every tracked process
+func (r *processRegistry) stopAll(grace time.Duration) {
+	r.mu.Lock()
+	procs := make([]*process, 0, len(r.procs))
+	for _, p := range r.procs {
+		procs = append(procs, p)
+	}
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, p := range procs {
+		wg.Add(1)
+		go func(p *process) {
+			defer wg.Done()
+			r.stop(p, grace)
+		}(p)
+	}
+	wg.Wait()
+}
+
+// sweep kills process groups left behind by recorders which are no longer running
+func (r *processRegistry) sweep(grace time.Duration) {
+	files, err := os.ReadDir(r.dir)
+	if err != nil {
+		return
+	}
+
+	for _, f := range files {
+		pid, err := strconv.Atoi(f.Name())
+		if err != nil {
+			continue
+		}
+
+		b, err := os.ReadFile(r.pidFile(pid))
+		if err != nil {
+			continue
+		}
+		var owner int
+		var ownerStart uint64
+		var name string
+		if _, err = fmt.Sscanf(string(b), "%d %d %s", &owner, &ownerStart, &name); err != nil {
+			_ = os.Remove(r.pidFile(pid))
+			continue
+		}
+		if start, err := processStartTime(owner); err == nil && start == ownerStart {
+			// still supervised
+			continue
+		}
+
+		// guard against the pid having been reused by something else
+		if processName(pid) == name {
+			logger.Infow("cleaning up orphaned process", "process", name, "pid", pid)
+			if err = syscall.Kill(-pid, syscall.SIGTERM); err == nil {
+				deadline := time.Now().Add(grace)
+				for processExists(pid) && time.Now().Before(deadline) {
+					time.Sleep(time.Millisecond * 100)
+				}
+				_ = syscall.Kill(-pid, syscall.SIGKILL)
+			}
+		}
+		_ = os.Remove(r.pidFile(pid))
+	}
+}
+
+// processStartTime returns when the process started, in clock ticks since boot. It tells a process apart from a
+// later one with the same pid, e.g. the recorder after a container restart.
+func processStartTime(pid int) (uint64, error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// the command name may contain spaces, so fields are counted from its closing parenthesis
+	i := bytes.LastIndexByte(b, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("invalid stat for pid %d", pid)
+	}
+	fields := strings.Fields(string(b[i+1:]))
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("invalid stat for pid %d", pid)
+	}
+	// starttime is field 22, counting the pid and name
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+var (
+	selfStart     uint64
+	selfStartOnce sync.Once
+)
+
+func selfStartTime() uint64 {
+	selfStartOnce.Do(func() {
+		var err error
+		if selfStart, err = processStartTime(os.Getpid()); err != nil {
+			logger.Errorw("failed to read process start time", err)
+		}
+	})
+	return selfStart
+}
+
+func (r *processRegistry) pidFile(pid int) string {
+	return filepath.Join(r.dir, strconv.Itoa(pid))
+}
+
+// processName returns the executable name from the process's command line.
+// Chrome may rewrite its command line as a single space separated argument.
+func processName(pid int) string {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return ""
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	argv0 := strings.SplitN(string(b), " ", 2)[0]
+	if argv0 == "" {
+		// exited, but not yet reaped
+		return ""
+	}
+	return filepath.Base(argv0)
+}
+
+// CleanupOrphans stops Xvfb and Chrome processes left behind by a recorder which crashed or was killed
+func CleanupOrphans() {
+	processes.sweep(stopGracePeriod)
+}
+
+// StopAll stops every child process still running
+func StopAll() {
+	processes.stopAll(stopGracePeriod)
+}
@@ -0,0 +1,70 @@
+package display
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessRegistry(t *testing.T) {
+	r := newProcessRegistry(t.TempDir())
+
+	// the shell ignores SIGTERM, and its child should be stopped with it
+	p, err := r.start(exec.Command("sh", "-c", "trap '' TERM; sleep 30 & echo $! > "+r.dir+"/child; wait"))
+	require.NoError(t, err)
+	require.FileExists(t, r.pidFile(p.pid))
+
+	var child int
+	require.Eventually(t, func() bool {
+		b, err := os.ReadFile(r.dir + "/child")
+		if err != nil {
+			return false
+		}
+		child, err = strconv.Atoi(strings.TrimSpace(string(b)))
+		return err == nil
+	}, time.Second, time.Millisecond*10)
+
+	r.stop(p, time.Millisecond*100)
+	<-p.done
+	require.NoFileExists(t, r.pidFile(p.pid))
+	// the orphaned child may be left as a zombie
+	require.Eventually(t, func() bool {
+		return !processExists(child) || processName(child) == ""
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestSweep(t *testing.T) {
+	r := newProcessRegistry(t.TempDir())
+
+	cmd := exec.Command("sleep", "30")
+	supervise(cmd)
+	require.NoError(t, cmd.Start())
+	done := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(done)
+	}()
+	pid := cmd.Process.Pid
+
+	// owned by this recorder
+	require.NoError(t, os.WriteFile(r.pidFile(pid), []byte(fmt.Sprintf("%d %d sleep\n", os.Getpid(), selfStartTime())), 0644))
+	r.sweep(time.Second)
+	require.FileExists(t, r.pidFile(pid))
+
+	// owned by an earlier recorder with the same pid, e.g. before a container restart
+	require.NoError(t, os.WriteFile(r.pidFile(pid), []byte(fmt.Sprintf("%d %d sleep\n", os.Getpid(), selfStartTime()-1)), 0644))
+	r.sweep(time.Second)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("orphaned process not stopped")
+	}
+	require.NoFileExists(t, r.pidFile(pid))
+}
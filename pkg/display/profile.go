@@ -0,0 +1,99 @@
+package display
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// profileLocks tracks persistent profiles in use, since chrome allows a single browser per profile
+type profileLocks struct {
+	mu    sync.Mutex
+	inUse map[string]bool
+}
+
+var profiles = &profileLocks{inUse: make(map[string]bool)}
+
+func (p *profileLocks) acquire(dir string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.inUse[dir] {
+		return ErrProfileInUse
+	}
+	p.inUse[dir] = true
+	return nil
+}
+
+func (p *profileLocks) release(dir string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.inUse, dir)
+}
+
+// userDataDir is the chrome profile of a recording. Temporary profiles are removed on close.
+type userDataDir struct {
+	path      string
+	temporary bool
+}
+
+// newUserDataDir locks a persistent profile, or creates a temporary one if there is none
+func newUserDataDir(recordingID, profileDir string) (*userDataDir, error) {
+	if profileDir != "" {
+		if err := profiles.acquire(profileDir); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(profileDir, 0700); err != nil {
+			profiles.release(profileDir)
+			return nil, err
+		}
+		return &userDataDir{path: profileDir}, nil
+	}
+
+	dir, err := os.MkdirTemp("", fmt.Sprintf("livekit-recorder-chrome-%s-", recordingID))
+	if err != nil {
+		return nil, err
+	}
+	return &userDataDir{path: dir, temporary: true}, nil
+}
+
+// close must be called once chrome has exited
+func (u *userDataDir) close() {
+	if u.temporary {
+		_ = os.RemoveAll(u.path)
+	} else {
+		profiles.release(u.path)
+	}
+}
+
+// redactFlags hides credentials in flag values, such as a proxy server, so flags can be logged
+func redactFlags(args []string) []string {
+	redactedArgs := make([]string, len(args))
+	for i, arg := range args {
+		if j := strings.Index(arg, "="); j >= 0 {
+			arg = arg[:j+1] + redactFlagValue(arg[j+1:])
+		}
+		redactedArgs[i] = arg
+	}
+	return redactedArgs
+}
+
+// redactFlagValue redacts urls and user:pass@host credentials, which may have no scheme, as in
+// --proxy-server=user:pass@proxy:3128, or be part of a list, as in --proxy-server=http=user:pass@proxy:3128;https=...
+func redactFlagValue(value string) string {
+	parts := strings.Split(value, ";")
+	for i, part := range parts {
+		switch {
+		case strings.Contains(part, "://"):
+			parts[i] = RedactURL(part)
+		case strings.Contains(part, "@"):
+			at := strings.LastIndex(part, "@")
+			prefix := ""
+			if eq := strings.Index(part[:at], "="); eq >= 0 {
+				prefix = part[:eq+1]
+			}
+			parts[i] = prefix + redacted + part[at:]
+		}
+	}
+	return strings.Join(parts, ";")
+}
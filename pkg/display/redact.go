@@ -0,0 +1,59 @@
+package display
+
+import (
+	"net/url"
+	"strings"
+)
+
+const redacted = "redacted"
+
+var secretParams = map[string]bool{
+	"token":        true,
+	"access_token": true,
+	"key":          true,
+	"secret":       true,
+	"password":     true,
+	"signature":    true,
+}
+
+// RedactURL hides credentials and secret query params, so the url can be logged
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+
+	u.RawQuery = redactQuery(u.RawQuery)
+
+	// templates carry their params in the fragment
+	fragment := u.EscapedFragment()
+	if i := strings.Index(fragment, "?"); i >= 0 {
+		fragment = fragment[:i+1] + redactQuery(fragment[i+1:])
+	}
+	u.Fragment, u.RawFragment = "", ""
+
+	if fragment == "" {
+		return u.String()
+	}
+	return u.String() + "#" + fragment
+}
+
+func redactQuery(query string) string {
+	if query == "" {
+		return query
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return redacted
+	}
+	for k := range values {
+		if secretParams[strings.ToLower(k)] {
+			values.Set(k, redacted)
+		}
+	}
+	return values.Encode()
+}
@@ -0,0 +1,172 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+)
+
+const (
+	analysisInterval = time.Second
+
+	// videoanalyse reports luma average and variance between 0 and 1
+	blackLuma       = 0.08
+	uniformVariance = 0.0005
+	frozenEpsilon   = 1e-6
+)
+
+type ConditionType string
+
+const (
+	ConditionBlack   ConditionType = "black"
+	ConditionUniform ConditionType = "uniform"
+	ConditionFrozen  ConditionType = "frozen"
+	ConditionSilence ConditionType = "silence"
+)
+
+// Condition is dead content which lasted past its threshold. It is sent once when detected,
+// and again with an end time once the content changes.
+type Condition struct {
+	Type  ConditionType `json:"type"`
+	Start time.Time     `json:"start"`
+	End   *time.Time    `json:"end,omitempty"`
+}
+
+func (c *Condition) String() string {
+	if c.End == nil {
+		return fmt.Sprintf("%s since %s", c.Type, c.Start.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%s from %s to %s", c.Type, c.Start.Format(time.RFC3339), c.End.Format(time.RFC3339))
+}
+
+// Analyzer detects dead content from videoanalyse and level measurements
+type Analyzer struct {
+	mu           sync.Mutex
+	conditions   chan *Condition
+	trackers     map[ConditionType]*tracker
+	silenceLevel float64
+
+	lastAverage  float64
+	lastVariance float64
+	hasLast      bool
+}
+
+type tracker struct {
+	threshold time.Duration
+	since     time.Time
+	reported  bool
+}
+
+func NewAnalyzer(conf *config.Analysis) *Analyzer {
+	a := &Analyzer{
+		conditions:   make(chan *Condition, 16),
+		trackers:     make(map[ConditionType]*tracker),
+		silenceLevel: conf.SilenceLevel,
+	}
+	for conditionType, threshold := range map[ConditionType]time.Duration{
+		ConditionBlack:   conf.Blank,
+		ConditionUniform: conf.Blank,
+		ConditionFrozen:  conf.Frozen,
+		ConditionSilence: conf.Silence,
+	} {
+		if threshold > 0 {
+			a.trackers[conditionType] = &tracker{threshold: threshold}
+		}
+	}
+	return a
+}
+
+// Conditions receives detected conditions, and their ends
+func (a *Analyzer) Conditions() <-chan *Condition {
+	return a.conditions
+}
+
+// Video handles a videoanalyse measurement
+func (a *Analyzer) Video(ts time.Time, average, variance float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	uniform := variance < uniformVariance
+	frozen := a.hasLast &&
+		math.Abs(average-a.lastAverage) < frozenEpsilon &&
+		math.Abs(variance-a.lastVariance) < frozenEpsilon
+	a.lastAverage, a.lastVariance, a.hasLast = average, variance, true
+
+	a.update(ConditionBlack, ts, uniform && average < blackLuma)
+	a.update(ConditionUniform, ts, uniform && average >= blackLuma)
+	// uniform frames never change, and are already reported
+	a.update(ConditionFrozen, ts, frozen && !uniform)
+}
+
+// Audio handles a level measurement, with the rms of each channel in dB
+func (a *Analyzer) Audio(ts time.Time, rms []float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	silent := len(rms) > 0
+	for _, level := range rms {
+		if level > a.silenceLevel {
+			silent = false
+		}
+	}
+	a.update(ConditionSilence, ts, silent)
+}
+
+func (a *Analyzer) update(conditionType ConditionType, ts time.Time, active bool) {
+	t := a.trackers[conditionType]
+	if t == nil {
+		return
+	}
+
+	switch {
+	case active && t.since.IsZero():
+		t.since = ts
+	case active && !t.reported && ts.Sub(t.since) >= t.threshold:
+		t.reported = true
+		a.send(&Condition{Type: conditionType, Start: t.since})
+	case !active:
+		if t.reported {
+			end := ts
+			a.send(&Condition{Type: conditionType, Start: t.since, End: &end})
+		}
+		t.since = time.Time{}
+		t.reported = false
+	}
+}
+
+func (a *Analyzer) send(c *Condition) {
+	select {
+	case a.conditions <- c:
+	default:
+	}
+}
+
+var rmsPattern = regexp.MustCompile(`rms=\([^)]*\)[<{]([^>}]*)[>}]`)
+
+// parseLevel reads the rms of each channel from a serialized level message
+func parseLevel(structure string) ([]float64, bool) {
+	match := rmsPattern.FindStringSubmatch(structure)
+	if match == nil {
+		return nil, false
+	}
+
+	var rms []float64
+	for _, field := range strings.Split(match[1], ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		level, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, false
+		}
+		rms = append(rms, level)
+	}
+	return rms, len(rms) > 0
+}
@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+)
+
+func TestAnalyzer(t *testing.T) {
+	a := NewAnalyzer(&config.Analysis{
+		Blank:        time.Second * 3,
+		Frozen:       time.Second * 3,
+		Silence:      time.Second * 2,
+		SilenceLevel: -60,
+	})
+	start := time.Now()
+	at := func(seconds int) time.Time {
+		return start.Add(time.Second * time.Duration(seconds))
+	}
+
+	// black frames, detected after 3s and ended by a real frame
+	for i := 0; i <= 3; i++ {
+		a.Video(at(i), 0.01, 0.0001)
+	}
+	c := <-a.Conditions()
+	require.Equal(t, ConditionBlack, c.Type)
+	require.Equal(t, start, c.Start)
+	require.Nil(t, c.End)
+
+	a.Video(at(4), 0.5, 0.05)
+	c = <-a.Conditions()
+	require.Equal(t, ConditionBlack, c.Type)
+	require.Equal(t, at(4), *c.End)
+
+	// the same frame again
+	for i := 5; i <= 8; i++ {
+		a.Video(at(i), 0.5, 0.05)
+	}
+	c = <-a.Conditions()
+	require.Equal(t, ConditionFrozen, c.Type)
+	require.Equal(t, at(5), c.Start)
+
+	// quiet, but not silent
+	a.Audio(at(0), []float64{-70, -40})
+	for i := 1; i <= 3; i++ {
+		a.Audio(at(i), []float64{-70, -75})
+	}
+	c = <-a.Conditions()
+	require.Equal(t, ConditionSilence, c.Type)
+	require.Equal(t, at(1), c.Start)
+
+	select {
+	case c = <-a.Conditions():
+		t.Fatalf("unexpected condition %s", c)
+	default:
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	rms, ok := parseLevel("level, endtime=(guint64)1000000000, rms=(GValueArray)< -20.5, -inf >, peak=(GValueArray)< -3, -4 >;")
+	require.True(t, ok)
+	require.Len(t, rms, 2)
+	require.Equal(t, -20.5, rms[0])
+
+	rms, ok = parseLevel("level, rms=(double){ -61.25 };")
+	require.True(t, ok)
+	require.Equal(t, []float64{-61.25}, rms)
+
+	_, ok = parseLevel("GstVideoAnalyse, luma-average=(double)0.5;")
+	require.False(t, ok)
+}
@@ -0,0 +1,37 @@
+//go:build !test
+// +build !test
+
+package pipeline
+
+// #cgo pkg-config: glib-2.0
+// #include <glib.h>
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/tinyzimmer/go-glib/glib"
+)
+
+// newMainContext gives a pipeline its own main context, so pipelines running side by side don't share a bus loop
+func newMainContext() *glib.MainContext {
+	return (*glib.MainContext)(unsafe.Pointer(C.g_main_context_new()))
+}
+
+// pushThreadDefault makes ctx the calling thread's default context, which bus watches attach to.
+// The goroutine must be locked to its thread until popThreadDefault.
+func pushThreadDefault(ctx *glib.MainContext) {
+	C.g_main_context_push_thread_default(nativeContext(ctx))
+}
+
+func popThreadDefault(ctx *glib.MainContext) {
+	C.g_main_context_pop_thread_default(nativeContext(ctx))
+}
+
+func unrefContext(ctx *glib.MainContext) {
+	C.g_main_context_unref(nativeContext(ctx))
+}
+
+func nativeContext(ctx *glib.MainContext) *C.GMainContext {
+	return (*C.GMainContext)(unsafe.Pointer(ctx))
+}
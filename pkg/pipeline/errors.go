@@ -11,6 +11,10 @@ var (
 	ErrGhostPadFailed       = errors.New("failed to add ghost pad to bin")
 	ErrOutputAlreadyExists  = errors.New("output already exists")
 	ErrOutputNotFound       = errors.New("output not found")
+	ErrPlayingTimeout       = errors.New("pipeline failed to start: timed out waiting for PLAYING, no output was written")
+	ErrEOSTimeout           = errors.New("pipeline failed to stop: timed out waiting for EOS, output is incomplete")
+	ErrStoppedBeforePlaying = errors.New("pipeline stopped before reaching PLAYING")
+	ErrForcedStop           = errors.New("pipeline forced to stop")
 
 	GErrNoURI            = "No URI set before starting"
 	GErrFailedToStart    = "Failed to start"
@@ -7,26 +7,32 @@ import (
 	"fmt"
 
 	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
 	"github.com/tinyzimmer/go-gst/gst"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
 )
 
 type InputBin struct {
 	isStream      bool
 	bin           *gst.Bin
+	source        *source
 	audioElements []*gst.Element
 	videoElements []*gst.Element
 	audioQueue    *gst.Element
 	videoQueue    *gst.Element
 	mux           *gst.Element
+	analyzer      *Analyzer
 }
 
-func newInputBin(isStream bool, options *livekit.RecordingOptions) (*InputBin, error) {
-	// create audio elements
-	pulseSrc, err := gst.NewElement("pulsesrc")
+func newInputBin(conf *config.Config, log logger.Logger, params *SourceParams, isStream bool, options *livekit.RecordingOptions) (*InputBin, error) {
+	// create source elements
+	src, err := newSource(conf, log, params, options)
 	if err != nil {
 		return nil, err
 	}
 
+	// create audio elements
 	audioConvert, err := gst.NewElement("audioconvert")
 	if err != nil {
 		return nil, err
@@ -61,19 +67,6 @@ func newInputBin(isStream bool, options *livekit.RecordingOptions) (*InputBin, e
 	}
 
 	// create video elements
-	xImageSrc, err := gst.NewElement("ximagesrc")
-	if err != nil {
-		return nil, err
-	}
-	err = xImageSrc.SetProperty("use-damage", false)
-	if err != nil {
-		return nil, err
-	}
-	err = xImageSrc.SetProperty("show-pointer", false)
-	if err != nil {
-		return nil, err
-	}
-
 	videoConvert, err := gst.NewElement("videoconvert")
 	if err != nil {
 		return nil, err
@@ -119,6 +112,30 @@ func newInputBin(isStream bool, options *livekit.RecordingOptions) (*InputBin, e
 		return nil, err
 	}
 
+	// measure content for analysis
+	var analysisElements []*gst.Element
+	var analyzer *Analyzer
+	if params.Analysis != nil && params.Analysis.Enabled() {
+		videoAnalyse, err := gst.NewElement("videoanalyse")
+		if err != nil {
+			return nil, err
+		}
+		if err = videoAnalyse.SetProperty("interval", uint64(analysisInterval)); err != nil {
+			return nil, err
+		}
+
+		level, err := gst.NewElement("level")
+		if err != nil {
+			return nil, err
+		}
+		if err = level.SetProperty("interval", uint64(analysisInterval)); err != nil {
+			return nil, err
+		}
+
+		analysisElements = []*gst.Element{videoAnalyse, level}
+		analyzer = NewAnalyzer(params.Analysis)
+	}
+
 	// create mux
 	var mux *gst.Element
 	if isStream {
@@ -143,17 +160,25 @@ func newInputBin(isStream bool, options *livekit.RecordingOptions) (*InputBin, e
 
 	// create bin
 	bin := gst.NewBin("input")
+	if err = bin.AddMany(src.elements()...); err != nil {
+		return nil, err
+	}
 	err = bin.AddMany(
 		// audio
-		pulseSrc, audioConvert, audioCapsFilter, faac, audioQueue,
+		audioConvert, audioCapsFilter, faac, audioQueue,
 		// video
-		xImageSrc, videoConvert, framerateCaps, x264Enc, profileCaps, videoQueue,
+		videoConvert, framerateCaps, x264Enc, profileCaps, videoQueue,
 		// mux
 		mux,
 	)
 	if err != nil {
 		return nil, err
 	}
+	if analyzer != nil {
+		if err = bin.AddMany(analysisElements...); err != nil {
+			return nil, err
+		}
+	}
 
 	// create ghost pad
 	ghostPad := gst.NewGhostPad("src", mux.GetStaticPad("src"))
@@ -161,18 +186,34 @@ func newInputBin(isStream bool, options *livekit.RecordingOptions) (*InputBin, e
 		return nil, ErrGhostPadFailed
 	}
 
+	audioElements := append(src.audioElements, audioConvert, audioCapsFilter)
+	videoElements := append(src.videoElements, videoConvert)
+	if analyzer != nil {
+		// measured after conversion, before encoding
+		videoElements = append(videoElements, analysisElements[0])
+		audioElements = append(audioElements, analysisElements[1])
+	}
+
 	return &InputBin{
 		isStream:      isStream,
 		bin:           bin,
-		audioElements: []*gst.Element{pulseSrc, audioConvert, audioCapsFilter, faac, audioQueue},
-		videoElements: []*gst.Element{xImageSrc, videoConvert, framerateCaps, x264Enc, profileCaps, videoQueue},
+		source:        src,
+		audioElements: append(audioElements, faac, audioQueue),
+		videoElements: append(videoElements, framerateCaps, x264Enc, profileCaps, videoQueue),
 		audioQueue:    audioQueue,
 		videoQueue:    videoQueue,
 		mux:           mux,
+		analyzer:      analyzer,
 	}, nil
 }
 
 func (b *InputBin) Link() error {
+	// link dynamic source pads
+	if err := b.source.linkDecoder(); err != nil {
+		return err
+	}
+	b.source.feedFrames()
+
 	// link audio elements
 	if err := gst.ElementLinkMany(b.audioElements...); err != nil {
 		return err
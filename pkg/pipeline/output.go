@@ -18,8 +18,9 @@ type OutputBin struct {
 	fileSink *gst.Element
 
 	// rtmp only
-	tee  *gst.Element
-	rtmp map[string]*RtmpOut
+	tee    *gst.Element
+	rtmp   map[string]*RtmpOut
+	logger logger.Logger
 }
 
 type RtmpOut struct {
@@ -60,7 +61,7 @@ func newFileOutputBin(filename string) (*OutputBin, error) {
 	}, nil
 }
 
-func newRtmpOutputBin(urls []string) (*OutputBin, error) {
+func newRtmpOutputBin(log logger.Logger, urls []string) (*OutputBin, error) {
 	// create elements
 	tee, err := gst.NewElement("tee")
 	if err != nil {
@@ -97,6 +98,7 @@ func newRtmpOutputBin(urls []string) (*OutputBin, error) {
 		bin:      bin,
 		tee:      tee,
 		rtmp:     rtmpOut,
+		logger:   log,
 	}, nil
 }
 
@@ -180,7 +182,7 @@ func (b *OutputBin) AddRtmpSink(url string) error {
 	teeSrcPad.AddProbe(gst.PadProbeTypeBlockDownstream, func(pad *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
 		// link tee to queue
 		if err = requireLink(pad, rtmp.queue.GetStaticPad("sink")); err != nil {
-			logger.Errorw("failed to link tee to queue", err)
+			b.logger.Errorw("failed to link tee to queue", err)
 		}
 
 		// sync state
@@ -217,13 +219,13 @@ func (b *OutputBin) RemoveRtmpSink(url string) error {
 
 		// remove from bin
 		if err := b.bin.RemoveMany(rtmp.queue, rtmp.sink); err != nil {
-			logger.Errorw("failed to remove rtmp queue", err)
+			b.logger.Errorw("failed to remove rtmp queue", err)
 		}
 		if err := rtmp.queue.SetState(gst.StateNull); err != nil {
-			logger.Errorw("failed stop rtmp queue", err)
+			b.logger.Errorw("failed stop rtmp queue", err)
 		}
 		if err := rtmp.sink.SetState(gst.StateNull); err != nil {
-			logger.Errorw("failed to stop rtmp sink", err)
+			b.logger.Errorw("failed to stop rtmp sink", err)
 		}
 
 		// release tee src pad
@@ -0,0 +1,23 @@
+package pipeline
+
+import (
+	"github.com/livekit/livekit-recorder/pkg/config"
+)
+
+// SourceParams are per recording source settings, which take precedence over the configured source
+type SourceParams struct {
+	// StreamUrl is decoded in place of the configured source when recording an existing media stream
+	StreamUrl string
+
+	// Display is the X display to capture
+	Display string
+
+	// Frames are jpeg frames captured from the page, in place of an X display
+	Frames <-chan []byte
+
+	// PulseDevice is captured instead of the default pulse source
+	PulseDevice string
+
+	// Analysis watches the captured audio and video for dead content, if enabled
+	Analysis *config.Analysis
+}
@@ -8,6 +8,9 @@ import (
 	"time"
 
 	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
 )
 
 type Pipeline struct {
@@ -16,14 +19,14 @@ type Pipeline struct {
 	kill      chan struct{}
 }
 
-func NewRtmpPipeline(rtmp []string, options *livekit.RecordingOptions) (*Pipeline, error) {
+func NewRtmpPipeline(conf *config.Config, log logger.Logger, src *SourceParams, rtmp []string, options *livekit.RecordingOptions) (*Pipeline, error) {
 	return &Pipeline{
 		isStream: true,
 		kill:     make(chan struct{}, 1),
 	}, nil
 }
 
-func NewFilePipeline(filename string, options *livekit.RecordingOptions) (*Pipeline, error) {
+func NewFilePipeline(conf *config.Config, log logger.Logger, src *SourceParams, filename string, options *livekit.RecordingOptions) (*Pipeline, error) {
 	return &Pipeline{
 		isStream: false,
 		kill:     make(chan struct{}, 1),
@@ -64,3 +67,22 @@ func (p *Pipeline) Abort() {
 func (p *Pipeline) Close() {
 	p.kill <- struct{}{}
 }
+
+func (p *Pipeline) ForceStop() {
+	select {
+	case p.kill <- struct{}{}:
+	default:
+	}
+}
+
+func (p *Pipeline) Messages() []string {
+	return nil
+}
+
+func (p *Pipeline) DotGraph() string {
+	return ""
+}
+
+func (p *Pipeline) Conditions() <-chan *Condition {
+	return nil
+}
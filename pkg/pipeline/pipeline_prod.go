@@ -6,6 +6,7 @@ package pipeline
 import (
 	"errors"
 	"fmt"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
@@ -14,10 +15,12 @@ import (
 	"github.com/livekit/protocol/logger"
 	"github.com/tinyzimmer/go-glib/glib"
 	"github.com/tinyzimmer/go-gst/gst"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
 )
 
 // gst.Init needs to be called before using gst but after gst package loads
-var initialized = false
+var initOnce sync.Once
 
 const pipelineSource = "pipeline"
 
@@ -25,7 +28,10 @@ type Pipeline struct {
 	mu sync.Mutex
 
 	pipeline *gst.Pipeline
+	context  *glib.MainContext
 	loop     *glib.MainLoop
+	timeouts config.Timeouts
+	logger   logger.Logger
 
 	output  *OutputBin
 	removed map[string]bool
@@ -33,35 +39,38 @@ type Pipeline struct {
 	started   chan struct{}
 	startedAt time.Time
 	closed    chan struct{}
+	ended     chan struct{}
+	eosTimer  *time.Timer
 
 	err error
+
+	// recent bus messages, for diagnostics
+	messages []string
+
+	analyzer *Analyzer
 }
 
-func NewRtmpPipeline(urls []string, options *livekit.RecordingOptions) (*Pipeline, error) {
-	if !initialized {
-		gst.Init(nil)
-		initialized = true
-	}
+const maxMessages = 200
 
-	input, err := newInputBin(true, options)
+func NewRtmpPipeline(conf *config.Config, log logger.Logger, src *SourceParams, urls []string, options *livekit.RecordingOptions) (*Pipeline, error) {
+	initOnce.Do(func() { gst.Init(nil) })
+
+	input, err := newInputBin(conf, log, src, true, options)
 	if err != nil {
 		return nil, err
 	}
-	output, err := newRtmpOutputBin(urls)
+	output, err := newRtmpOutputBin(log, urls)
 	if err != nil {
 		return nil, err
 	}
 
-	return newPipeline(input, output)
+	return newPipeline(conf, log, input, output)
 }
 
-func NewFilePipeline(filename string, options *livekit.RecordingOptions) (*Pipeline, error) {
-	if !initialized {
-		gst.Init(nil)
-		initialized = true
-	}
+func NewFilePipeline(conf *config.Config, log logger.Logger, src *SourceParams, filename string, options *livekit.RecordingOptions) (*Pipeline, error) {
+	initOnce.Do(func() { gst.Init(nil) })
 
-	input, err := newInputBin(false, options)
+	input, err := newInputBin(conf, log, src, false, options)
 	if err != nil {
 		return nil, err
 	}
@@ -70,10 +79,10 @@ func NewFilePipeline(filename string, options *livekit.RecordingOptions) (*Pipel
 		return nil, err
 	}
 
-	return newPipeline(input, output)
+	return newPipeline(conf, log, input, output)
 }
 
-func newPipeline(input *InputBin, output *OutputBin) (*Pipeline, error) {
+func newPipeline(conf *config.Config, log logger.Logger, input *InputBin, output *OutputBin) (*Pipeline, error) {
 	// elements must be added to pipeline before linking
 	pipeline, err := gst.NewPipeline("pipeline")
 	if err != nil {
@@ -98,25 +107,43 @@ func newPipeline(input *InputBin, output *OutputBin) (*Pipeline, error) {
 		return nil, err
 	}
 
+	context := newMainContext()
 	return &Pipeline{
 		pipeline: pipeline,
+		context:  context,
+		loop:     glib.NewMainLoop(context, false),
+		timeouts: conf.Timeouts,
+		logger:   log,
 		output:   output,
+		analyzer: input.analyzer,
 		removed:  make(map[string]bool),
 		started:  make(chan struct{}),
 		closed:   make(chan struct{}),
+		ended:    make(chan struct{}),
 	}, nil
 }
 
 func (p *Pipeline) Run() error {
+	defer close(p.ended)
+
+	// the bus watch attaches to the thread's default context, which is the pipeline's own while it runs
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	pushThreadDefault(p.context)
+	defer func() {
+		popThreadDefault(p.context)
+		unrefContext(p.context)
+	}()
+
 	// add watch
-	p.loop = glib.NewMainLoop(glib.MainContextDefault(), false)
 	p.pipeline.GetPipelineBus().AddWatch(func(msg *gst.Message) bool {
+		p.recordMessage(msg)
 		switch msg.Type() {
 		case gst.MessageEOS:
 			// EOS received - close and return
-			logger.Debugw("EOS received, stopping pipeline")
+			p.logger.Debugw("EOS received, stopping pipeline")
 			_ = p.pipeline.BlockSetState(gst.StateNull)
-			logger.Debugw("pipeline stopped")
+			p.logger.Debugw("pipeline stopped")
 
 			p.loop.Quit()
 			return false
@@ -125,12 +152,13 @@ func (p *Pipeline) Run() error {
 			gErr := msg.ParseError()
 			err, handled := p.handleError(gErr)
 			if handled {
-				logger.Errorw("error handled", errors.New(gErr.Error()))
+				p.logger.Errorw("error handled", errors.New(gErr.Error()))
 			} else {
-				p.err = err
-				p.loop.Quit()
+				p.quit(err)
 				return false
 			}
+		case gst.MessageElement:
+			p.analyze(msg)
 		case gst.MessageStateChanged:
 			if msg.Source() == pipelineSource && p.startedAt.IsZero() {
 				_, newState := msg.ParseStateChanged()
@@ -140,7 +168,7 @@ func (p *Pipeline) Run() error {
 				}
 			}
 		default:
-			logger.Debugw(msg.String())
+			p.logger.Debugw(msg.String())
 		}
 
 		return true
@@ -151,9 +179,113 @@ func (p *Pipeline) Run() error {
 		return err
 	}
 
-	// run main loop
-	p.loop.Run()
-	return p.err
+	if p.timeouts.Playing > 0 {
+		playingTimer := time.AfterFunc(p.timeouts.Playing, func() {
+			select {
+			case <-p.started:
+			default:
+				p.logger.Infow("pipeline did not reach PLAYING", "timeout", p.timeouts.Playing)
+				p.quit(ErrPlayingTimeout)
+			}
+		})
+		defer playingTimer.Stop()
+	}
+
+	// run main loop, unless the pipeline was stopped before it could start
+	p.mu.Lock()
+	stopped := p.err != nil
+	p.mu.Unlock()
+	if !stopped {
+		p.loop.Run()
+	}
+
+	p.mu.Lock()
+	if p.eosTimer != nil {
+		p.eosTimer.Stop()
+	}
+	err := p.err
+	p.mu.Unlock()
+
+	// a pipeline which timed out or was forced to stop never reached NULL
+	if err != nil {
+		_ = p.pipeline.SetState(gst.StateNull)
+	}
+	// stopping before PLAYING is a clean abort, with nothing written
+	if errors.Is(err, ErrStoppedBeforePlaying) {
+		return nil
+	}
+	return err
+}
+
+func (p *Pipeline) recordMessage(msg *gst.Message) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.messages = append(p.messages, fmt.Sprintf("%s %s", time.Now().Format(time.RFC3339Nano), msg.String()))
+	if len(p.messages) > maxMessages {
+		p.messages = p.messages[len(p.messages)-maxMessages:]
+	}
+}
+
+// analyze passes videoanalyse and level measurements to the analyzer
+func (p *Pipeline) analyze(msg *gst.Message) {
+	s := msg.GetStructure()
+	if p.analyzer == nil || s == nil {
+		return
+	}
+
+	switch s.Name() {
+	case "GstVideoAnalyse":
+		average, err := s.GetValue("luma-average")
+		if err != nil {
+			return
+		}
+		variance, err := s.GetValue("luma-variance")
+		if err != nil {
+			return
+		}
+		if average, ok := average.(float64); ok {
+			if variance, ok := variance.(float64); ok {
+				p.analyzer.Video(time.Now(), average, variance)
+			}
+		}
+	case "level":
+		if rms, ok := parseLevel(s.String()); ok {
+			p.analyzer.Audio(time.Now(), rms)
+		}
+	}
+}
+
+// Conditions receives dead content detected by analysis. It is nil if analysis is disabled.
+func (p *Pipeline) Conditions() <-chan *Condition {
+	if p.analyzer == nil {
+		return nil
+	}
+	return p.analyzer.Conditions()
+}
+
+// Messages returns the most recent bus messages
+func (p *Pipeline) Messages() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string{}, p.messages...)
+}
+
+// DotGraph returns the pipeline graph in graphviz dot format. Element params are left out, since locations and uris
+// carry stream keys and tokens.
+func (p *Pipeline) DotGraph() string {
+	return p.pipeline.DebugBinToDotData(gst.DebugGraphShowMediaType | gst.DebugGraphShowCapsDetails | gst.DebugGraphShowStates)
+}
+
+// quit stops the main loop, keeping the first error as the reason
+func (p *Pipeline) quit(err error) {
+	p.mu.Lock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.mu.Unlock()
+
+	p.loop.Quit()
 }
 
 func (p *Pipeline) GetStartTime() time.Time {
@@ -162,6 +294,8 @@ func (p *Pipeline) GetStartTime() time.Time {
 		return p.startedAt
 	case <-p.closed:
 		return p.startedAt
+	case <-p.ended:
+		return p.startedAt
 	}
 }
 
@@ -183,26 +317,55 @@ func (p *Pipeline) Abort() {
 	}
 }
 
-// Close waits for the pipeline to start before closing
+// Close waits for the pipeline to start before closing. Without a playing timeout, a pipeline which has not started
+// is stopped right away, since it might never start, and Run returns no error. If the pipeline does not finish
+// within the EOS timeout, it is forced to stop.
 func (p *Pipeline) Close() {
+	if p.timeouts.Playing <= 0 {
+		select {
+		case <-p.started:
+		case <-p.ended:
+			return
+		default:
+			p.Abort()
+			p.quit(ErrStoppedBeforePlaying)
+			return
+		}
+	}
+
 	select {
 	case <-p.closed:
 		return
+	case <-p.ended:
+		return
 	case <-p.started:
 		close(p.closed)
 
-		logger.Debugw("sending EOS to pipeline")
+		p.logger.Debugw("sending EOS to pipeline")
+		if p.timeouts.EOS > 0 {
+			p.mu.Lock()
+			p.eosTimer = time.AfterFunc(p.timeouts.EOS, func() {
+				p.logger.Infow("EOS not received, forcing pipeline to stop", "timeout", p.timeouts.EOS)
+				p.quit(ErrEOSTimeout)
+			})
+			p.mu.Unlock()
+		}
 		p.pipeline.SendEvent(gst.NewEOSEvent())
 	}
 }
 
+// ForceStop stops the main loop without waiting for EOS. Run sets the pipeline to NULL before returning.
+func (p *Pipeline) ForceStop() {
+	p.quit(ErrForcedStop)
+}
+
 // handleError returns true if the error has been handled, false if the pipeline should quit
 func (p *Pipeline) handleError(gErr *gst.GError) (error, bool) {
 	err := errors.New(gErr.Error())
 
 	element, reason, ok := parseDebugInfo(gErr.DebugString())
 	if !ok {
-		logger.Errorw("failed to parse pipeline error", err, "debug", gErr.DebugString())
+		p.logger.Errorw("failed to parse pipeline error", err, "debug", gErr.DebugString())
 		return err, false
 	}
 
@@ -210,7 +373,7 @@ func (p *Pipeline) handleError(gErr *gst.GError) (error, bool) {
 	case GErrNoURI, GErrCouldNotConnect:
 		// bad URI or could not connect. Remove rtmp output
 		if err := p.output.RemoveSinkByName(element); err != nil {
-			logger.Errorw("failed to remove sink", err)
+			p.logger.Errorw("failed to remove sink", err)
 			return err, false
 		}
 		p.removed[element] = true
@@ -220,7 +383,7 @@ func (p *Pipeline) handleError(gErr *gst.GError) (error, bool) {
 		// should be preceded by a GErrNoURI on the same sink
 		handled := p.removed[element]
 		if !handled {
-			logger.Errorw("element failed to start", err)
+			p.logger.Errorw("element failed to start", err)
 		}
 		return err, handled
 	case GErrStreamingStopped:
@@ -231,12 +394,12 @@ func (p *Pipeline) handleError(gErr *gst.GError) (error, bool) {
 			handled = p.removed[fmt.Sprint("sink_", element[6:])]
 		}
 		if !handled {
-			logger.Errorw("streaming sink stopped", err)
+			p.logger.Errorw("streaming sink stopped", err)
 		}
 		return err, handled
 	default:
 		// input failure or file write failure. Fatal
-		logger.Errorw("pipeline error", err, "debug", gErr.DebugString())
+		p.logger.Errorw("pipeline error", err, "debug", gErr.DebugString())
 		return err, false
 	}
 }
@@ -0,0 +1,365 @@
+//go:build !test
+// +build !test
+
+package pipeline
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+	"github.com/tinyzimmer/go-gst/gst"
+	"github.com/tinyzimmer/go-gst/gst/app"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+)
+
+// source produces raw audio and video for the input bin
+type source struct {
+	// audio and video elements are linked in order, ahead of the encoders
+	audioElements []*gst.Element
+	videoElements []*gst.Element
+
+	// decoder has dynamic pads, which get linked to the first audio and video elements
+	decoder *gst.Element
+
+	// appSrc is fed jpeg frames, in place of capturing an X display
+	appSrc    *app.Source
+	frames    <-chan []byte
+	framerate int32
+
+	logger logger.Logger
+}
+
+func newSource(conf *config.Config, log logger.Logger, params *SourceParams, options *livekit.RecordingOptions) (*source, error) {
+	if params != nil && params.StreamUrl != "" {
+		return newDecodedSource(log, params.StreamUrl, options)
+	}
+
+	switch conf.Source.Type {
+	case config.SourceTest:
+		return newTestSource(conf, options)
+	case config.SourceFile:
+		uri, err := fileURI(conf.Source.File)
+		if err != nil {
+			return nil, err
+		}
+		return newDecodedSource(log, uri, options)
+	default:
+		if params != nil && params.Frames != nil {
+			return newFrameSource(params, options)
+		}
+		return newScreenSource(params)
+	}
+}
+
+// newScreenSource captures the recording's X display and pulse device
+func newScreenSource(params *SourceParams) (*source, error) {
+	pulseSrc, err := gst.NewElement("pulsesrc")
+	if err != nil {
+		return nil, err
+	}
+	if params != nil && params.PulseDevice != "" {
+		if err = pulseSrc.SetProperty("device", params.PulseDevice); err != nil {
+			return nil, err
+		}
+	}
+
+	xImageSrc, err := gst.NewElement("ximagesrc")
+	if err != nil {
+		return nil, err
+	}
+	if params != nil && params.Display != "" {
+		if err = xImageSrc.SetProperty("display-name", params.Display); err != nil {
+			return nil, err
+		}
+	}
+	err = xImageSrc.SetProperty("use-damage", false)
+	if err != nil {
+		return nil, err
+	}
+	err = xImageSrc.SetProperty("show-pointer", false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &source{
+		audioElements: []*gst.Element{pulseSrc},
+		videoElements: []*gst.Element{xImageSrc},
+	}, nil
+}
+
+// newFrameSource decodes frames sent by the page, and captures the recording's pulse device
+func newFrameSource(params *SourceParams, options *livekit.RecordingOptions) (*source, error) {
+	pulseSrc, err := gst.NewElement("pulsesrc")
+	if err != nil {
+		return nil, err
+	}
+	if params.PulseDevice != "" {
+		if err = pulseSrc.SetProperty("device", params.PulseDevice); err != nil {
+			return nil, err
+		}
+	}
+
+	appSrc, err := app.NewAppSrc()
+	if err != nil {
+		return nil, err
+	}
+	appSrc.SetCaps(gst.NewCapsFromString(fmt.Sprintf("image/jpeg,framerate=%d/1", options.Framerate)))
+	appSrc.SetStreamType(app.AppStreamTypeStream)
+	if err = appSrc.SetProperty("is-live", true); err != nil {
+		return nil, err
+	}
+	if err = appSrc.SetProperty("do-timestamp", true); err != nil {
+		return nil, err
+	}
+	appSrc.SetArg("format", "time")
+
+	jpegDec, err := gst.NewElement("jpegdec")
+	if err != nil {
+		return nil, err
+	}
+	videoConvert, err := gst.NewElement("videoconvert")
+	if err != nil {
+		return nil, err
+	}
+	videoScale, err := gst.NewElement("videoscale")
+	if err != nil {
+		return nil, err
+	}
+	videoRate, err := gst.NewElement("videorate")
+	if err != nil {
+		return nil, err
+	}
+	videoCaps, err := newVideoCaps(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &source{
+		audioElements: []*gst.Element{pulseSrc},
+		videoElements: []*gst.Element{appSrc.Element, jpegDec, videoConvert, videoScale, videoRate, videoCaps},
+		appSrc:        appSrc,
+		frames:        params.Frames,
+		framerate:     options.Framerate,
+	}, nil
+}
+
+// newTestSource generates a live test pattern and tone
+func newTestSource(conf *config.Config, options *livekit.RecordingOptions) (*source, error) {
+	audioTestSrc, err := gst.NewElement("audiotestsrc")
+	if err != nil {
+		return nil, err
+	}
+	if err = audioTestSrc.SetProperty("is-live", true); err != nil {
+		return nil, err
+	}
+	if conf.Source.AudioTone > 0 {
+		if err = audioTestSrc.SetProperty("freq", conf.Source.AudioTone); err != nil {
+			return nil, err
+		}
+	} else {
+		audioTestSrc.SetArg("wave", "silence")
+	}
+
+	videoTestSrc, err := gst.NewElement("videotestsrc")
+	if err != nil {
+		return nil, err
+	}
+	if err = videoTestSrc.SetProperty("is-live", true); err != nil {
+		return nil, err
+	}
+	if conf.Source.VideoPattern != "" {
+		videoTestSrc.SetArg("pattern", conf.Source.VideoPattern)
+	}
+
+	videoCaps, err := newVideoCaps(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &source{
+		audioElements: []*gst.Element{audioTestSrc},
+		videoElements: []*gst.Element{videoTestSrc, videoCaps},
+	}, nil
+}
+
+// newDecodedSource decodes any uri supported by uridecodebin, scaled and paced to the recording options
+func newDecodedSource(log logger.Logger, uri string, options *livekit.RecordingOptions) (*source, error) {
+	decoder, err := gst.NewElement("uridecodebin")
+	if err != nil {
+		return nil, err
+	}
+	if err = decoder.SetProperty("uri", uri); err != nil {
+		return nil, err
+	}
+
+	// audio elements
+	audioConvert, err := gst.NewElement("audioconvert")
+	if err != nil {
+		return nil, err
+	}
+	audioResample, err := gst.NewElement("audioresample")
+	if err != nil {
+		return nil, err
+	}
+	audioSync, err := newSyncIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	// video elements
+	videoConvert, err := gst.NewElement("videoconvert")
+	if err != nil {
+		return nil, err
+	}
+	videoScale, err := gst.NewElement("videoscale")
+	if err != nil {
+		return nil, err
+	}
+	videoRate, err := gst.NewElement("videorate")
+	if err != nil {
+		return nil, err
+	}
+	videoCaps, err := newVideoCaps(options)
+	if err != nil {
+		return nil, err
+	}
+	videoSync, err := newSyncIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	return &source{
+		audioElements: []*gst.Element{audioConvert, audioResample, audioSync},
+		videoElements: []*gst.Element{videoConvert, videoScale, videoRate, videoCaps, videoSync},
+		decoder:       decoder,
+		logger:        log,
+	}, nil
+}
+
+// elements returns every element owned by the source
+func (s *source) elements() []*gst.Element {
+	elements := make([]*gst.Element, 0, len(s.audioElements)+len(s.videoElements)+1)
+	if s.decoder != nil {
+		elements = append(elements, s.decoder)
+	}
+	elements = append(elements, s.audioElements...)
+	return append(elements, s.videoElements...)
+}
+
+// linkDecoder links decoded pads as they appear. Any stream missing from the source gets an EOS,
+// so the muxer does not wait on it forever.
+func (s *source) linkDecoder() error {
+	if s.decoder == nil {
+		return nil
+	}
+
+	audioSink := s.audioElements[0].GetStaticPad("sink")
+	videoSink := s.videoElements[0].GetStaticPad("sink")
+
+	if _, err := s.decoder.Connect("pad-added", func(_ *gst.Element, pad *gst.Pad) {
+		caps := pad.GetCurrentCaps()
+		if caps == nil || caps.GetSize() == 0 {
+			return
+		}
+
+		var sink *gst.Pad
+		name := caps.GetStructureAt(0).Name()
+		switch {
+		case strings.HasPrefix(name, "audio/"):
+			sink = audioSink
+		case strings.HasPrefix(name, "video/"):
+			sink = videoSink
+		default:
+			return
+		}
+
+		if sink.IsLinked() {
+			s.logger.Debugw("ignoring additional decoded stream", "caps", name)
+			return
+		}
+		if err := requireLink(pad, sink); err != nil {
+			s.logger.Errorw("failed to link decoded stream", err, "caps", name)
+		}
+	}); err != nil {
+		return err
+	}
+
+	_, err := s.decoder.Connect("no-more-pads", func(_ *gst.Element) {
+		for _, sink := range []*gst.Pad{audioSink, videoSink} {
+			if !sink.IsLinked() {
+				s.logger.Infow("source missing stream", "pad", sink.GetParentElement().GetName())
+				sink.SendEvent(gst.NewEOSEvent())
+			}
+		}
+	})
+	return err
+}
+
+// feedFrames pushes the latest frame at the recording's framerate, since pages only send frames when they change.
+// The stream ends once the frames channel is closed.
+func (s *source) feedFrames() {
+	if s.appSrc == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Second / time.Duration(s.framerate))
+		defer ticker.Stop()
+
+		var frame []byte
+		for {
+			select {
+			case f, ok := <-s.frames:
+				if !ok {
+					s.appSrc.EndStream()
+					return
+				}
+				frame = f
+			case <-ticker.C:
+				if frame != nil {
+					s.appSrc.PushBuffer(gst.NewBufferFromBytes(frame))
+				}
+			}
+		}
+	}()
+}
+
+func newVideoCaps(options *livekit.RecordingOptions) (*gst.Element, error) {
+	videoCaps, err := gst.NewElement("capsfilter")
+	if err != nil {
+		return nil, err
+	}
+	err = videoCaps.SetProperty("caps", gst.NewCapsFromString(
+		fmt.Sprintf("video/x-raw,width=%d,height=%d,framerate=%d/1", options.Width, options.Height, options.Framerate),
+	))
+	if err != nil {
+		return nil, err
+	}
+	return videoCaps, nil
+}
+
+// newSyncIdentity paces buffers to the pipeline clock, so non-live sources behave like captured ones
+func newSyncIdentity() (*gst.Element, error) {
+	identity, err := gst.NewElement("identity")
+	if err != nil {
+		return nil, err
+	}
+	if err = identity.SetProperty("sync", true); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+func fileURI(filename string) (string, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: "file", Path: abs}).String(), nil
+}
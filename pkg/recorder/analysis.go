@@ -0,0 +1,52 @@
+package recorder
+
+import (
+	"fmt"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+	"github.com/livekit/livekit-recorder/pkg/pipeline"
+)
+
+// watchContent keeps dead content conditions, and stops the recording if the policy says so
+func (r *Recorder) watchContent(p *pipeline.Pipeline) {
+	conditions := p.Conditions()
+	if conditions == nil {
+		return
+	}
+
+	for {
+		select {
+		case <-r.abort:
+			return
+		case <-r.done:
+			return
+		case c := <-conditions:
+			r.logger.Infow("dead content", "condition", c.String())
+			r.addCondition(c)
+
+			if c.End == nil && r.opts.Analysis.Action == config.AnalysisStop {
+				r.stopWithReason(fmt.Errorf("%w: %s", ErrDeadContent, c))
+			}
+		}
+	}
+}
+
+// addCondition records a detected condition, or the end of one already recorded
+func (r *Recorder) addCondition(c *pipeline.Condition) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, existing := range r.conditions {
+		if existing.Type == c.Type && existing.Start.Equal(c.Start) {
+			r.conditions[i] = c
+			return
+		}
+	}
+	r.conditions = append(r.conditions, c)
+}
+
+func (r *Recorder) getConditions() []*pipeline.Condition {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*pipeline.Condition{}, r.conditions...)
+}
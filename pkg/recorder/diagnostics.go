@@ -0,0 +1,157 @@
+package recorder
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/livekit/protocol/livekit"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+	"github.com/livekit/livekit-recorder/pkg/diagnostics"
+	"github.com/livekit/livekit-recorder/pkg/display"
+)
+
+const redacted = "redacted"
+
+// saveDiagnostics bundles everything known about a failed recording, and saves it with the file output
+func (r *Recorder) saveDiagnostics(res *livekit.RecordingInfo) (string, error) {
+	b := diagnostics.NewBundle()
+	b.Add("error.txt", []byte(res.Error+"\n"))
+
+	if r.req != nil {
+		req, err := protojson.MarshalOptions{Multiline: true}.Marshal(redactRequest(r.req))
+		if err == nil {
+			b.Add("request.json", req)
+		}
+	}
+	if opts, err := yaml.Marshal(redactOptions(r.opts)); err == nil {
+		b.Add("options.yaml", opts)
+	}
+	if r.display != nil {
+		screenshot, err := r.display.Screenshot()
+		if err != nil {
+			r.logger.Infow("failed to capture screenshot", "error", err)
+		}
+		b.Add("screenshot.png", screenshot)
+	}
+	if r.pipeline != nil {
+		b.Add("pipeline.dot", []byte(r.pipeline.DotGraph()))
+		b.AddLines("gstreamer.log", redactLines(r.pipeline.Messages()))
+	}
+	b.AddLines("recorder.log", r.recentLogs())
+
+	tmp := filepath.Join(os.TempDir(), fmt.Sprintf("%s.diagnostics.tar.gz", r.ID))
+	if err := b.Write(tmp); err != nil {
+		return "", err
+	}
+
+	location, err := r.upload(tmp, path.Join(r.conf.Diagnostics.Path, path.Base(tmp)), "application/gzip")
+	if err != nil || location != "" {
+		_ = os.Remove(tmp)
+		return location, err
+	}
+
+	// no storage configured, keep it locally. The path is absolute, checked by config.
+	if err = os.MkdirAll(r.conf.Diagnostics.Path, 0755); err != nil {
+		return "", err
+	}
+	local := filepath.Join(r.conf.Diagnostics.Path, path.Base(tmp))
+	if err = os.Rename(tmp, local); err != nil {
+		// temp dir may be on another device
+		err = copyFile(tmp, local)
+		_ = os.Remove(tmp)
+		if err != nil {
+			return "", err
+		}
+	}
+	return local, nil
+}
+
+var urlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'\\]+`)
+
+// recentLogs returns the recent log lines about this recording, including those from its display and pipeline
+func (r *Recorder) recentLogs() []string {
+	return redactLines(r.logs.Lines())
+}
+
+// redactLines redacts any urls found in log lines
+func redactLines(lines []string) []string {
+	res := make([]string, len(lines))
+	for i, line := range lines {
+		res[i] = urlPattern.ReplaceAllStringFunc(line, redactStreamUrl)
+	}
+	return res
+}
+
+// redactRequest removes credentials from input and output urls
+func redactRequest(req *livekit.StartRecordingRequest) *livekit.StartRecordingRequest {
+	req = proto.Clone(req).(*livekit.StartRecordingRequest)
+	if input, ok := req.Input.(*livekit.StartRecordingRequest_Url); ok {
+		input.Url = redactStreamUrl(input.Url)
+	}
+	if output, ok := req.Output.(*livekit.StartRecordingRequest_Rtmp); ok {
+		for i, u := range output.Rtmp.Urls {
+			output.Rtmp.Urls[i] = redactStreamUrl(u)
+		}
+	}
+	return req
+}
+
+// redactStreamUrl redacts secrets, including stream keys, which are the last part of rtmp paths
+func redactStreamUrl(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme == "rtmp" || scheme == "rtmps" {
+		if idx := strings.LastIndex(u.Path, "/"); idx > 0 {
+			u.Path = u.Path[:idx+1] + redacted
+		}
+	}
+	return display.RedactURL(u.String())
+}
+
+// redactOptions removes header values, cookie values and passwords from page options, and presigned upload urls
+func redactOptions(opts *config.RequestOptions) *config.RequestOptions {
+	if opts == nil {
+		return nil
+	}
+	res := *opts
+	page := &res.Page
+
+	headers := make(map[string]string, len(page.Headers))
+	for name := range page.Headers {
+		headers[name] = redacted
+	}
+	page.Headers = headers
+
+	cookies := make([]config.Cookie, len(page.Cookies))
+	for i, c := range page.Cookies {
+		c.Value = redacted
+		cookies[i] = c
+	}
+	page.Cookies = cookies
+
+	if page.BasicAuth != nil {
+		page.BasicAuth = &config.BasicAuth{
+			Username: page.BasicAuth.Username,
+			Password: redacted,
+		}
+	}
+
+	uploadUrls := make(map[string]string, len(res.UploadUrls))
+	for storagePath := range res.UploadUrls {
+		uploadUrls[storagePath] = redacted
+	}
+	res.UploadUrls = uploadUrls
+	return &res
+}
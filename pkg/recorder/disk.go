@@ -0,0 +1,49 @@
+package recorder
+
+import (
+	"fmt"
+	"path"
+	"syscall"
+
+	"github.com/livekit/protocol/livekit"
+)
+
+// getFreeSpace returns the bytes available to unprivileged users on the filesystem containing dir
+func getFreeSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
+
+// outputDir returns the directory the file is written to, whether local or staged for upload
+func (r *Recorder) outputDir() string {
+	return path.Dir(r.filename)
+}
+
+// checkDiskSpace ensures there is room for the expected recording size on top of the stop threshold
+func (r *Recorder) checkDiskSpace(options *livekit.RecordingOptions) error {
+	free, err := getFreeSpace(r.outputDir())
+	if err != nil {
+		return err
+	}
+
+	// the file can grow up to the smaller of both limits
+	var expected uint64
+	if r.opts.GetMaxFileSize() > 0 {
+		expected = uint64(r.opts.GetMaxFileSize())
+	}
+	if r.opts.GetMaxDuration() > 0 {
+		bytesPerSecond := uint64(options.VideoBitrate+options.AudioBitrate) * 1000 / 8
+		if estimate := bytesPerSecond * uint64(r.opts.GetMaxDuration().Seconds()); expected == 0 || estimate < expected {
+			expected = estimate
+		}
+	}
+	required := uint64(r.conf.DiskSpace.StopThreshold) + expected
+
+	if free < required {
+		return fmt.Errorf("%w: %d bytes free, %d required", ErrInsufficientDiskSpace, free, required)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+	"github.com/livekit/livekit-recorder/pkg/display"
+	"github.com/livekit/livekit-recorder/pkg/pipeline"
+)
+
+// Metadata is written next to file recordings which received page events, or had dead content
+type Metadata struct {
+	RecordingID string               `json:"recording_id"`
+	StartedAt   time.Time            `json:"started_at"`
+	Events      []*MetadataEvent     `json:"events"`
+	Conditions  []*MetadataCondition `json:"conditions,omitempty"`
+	StopReason  string               `json:"stop_reason,omitempty"` // set if a limit or policy ended the recording
+}
+
+type MetadataEvent struct {
+	*display.Event
+	Offset int64 `json:"offset_ms"` // time since the recording started
+}
+
+type MetadataCondition struct {
+	Type      pipeline.ConditionType `json:"type"`
+	Offset    int64                  `json:"offset_ms"`               // time since the recording started
+	EndOffset *int64                 `json:"end_offset_ms,omitempty"` // unset if it lasted until the end
+}
+
+// handleEvents acts on page events, and keeps them for the recording metadata
+func (r *Recorder) handleEvents(d *display.Display) {
+	for {
+		select {
+		case <-r.abort:
+			return
+		case <-r.done:
+			return
+		case ev := <-d.Events():
+			r.logger.Infow("page event", "event", ev.Event, "label", ev.Label)
+
+			r.mu.Lock()
+			r.events = append(r.events, ev)
+			r.mu.Unlock()
+
+			switch ev.Event {
+			case display.EventLayout:
+				r.setLayout(d, ev.Layout)
+			case display.EventError:
+				if r.endOnPageError() {
+					r.fail(fmt.Errorf("%w: %s", ErrPageError, ev.Error))
+				} else {
+					r.logger.Infow("ignoring page error", "error", ev.Error)
+				}
+			}
+		}
+	}
+}
+
+// endOnPageError applies the page error policy. Pages loaded by navigate requests are the caller's responsibility.
+func (r *Recorder) endOnPageError() bool {
+	policy := r.conf.OnPageError
+	if policy.Action != config.PageErrorEnd {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !policy.InitialPageOnly || !r.navigated
+}
+
+// setLayout switches templates to another layout. Other pages choose their own layout.
+func (r *Recorder) setLayout(d *display.Display, layout string) {
+	if r.inputType != InputTemplate || layout == "" {
+		r.logger.Infow("ignoring layout change", "layout", layout)
+		return
+	}
+	if err := d.Navigate(r.templateUrl(layout), nil); err != nil {
+		r.logger.Errorw("failed to change layout", err, "layout", layout)
+		return
+	}
+
+	r.mu.Lock()
+	r.layout = layout
+	r.navigated = false
+	r.mu.Unlock()
+}
+
+// writeMetadata writes page events, conditions and any stop reason to a json file next to the recording, returning its path
+func (r *Recorder) writeMetadata(startedAt time.Time) (string, error) {
+	r.mu.Lock()
+	events := r.events
+	conditions := r.conditions
+	r.mu.Unlock()
+	stopReason := r.StopReason()
+	if len(events) == 0 && len(conditions) == 0 && stopReason == "" {
+		return "", nil
+	}
+
+	metadata := &Metadata{
+		RecordingID: r.ID,
+		StartedAt:   startedAt,
+		Events:      make([]*MetadataEvent, 0, len(events)),
+		StopReason:  stopReason,
+	}
+	for _, ev := range events {
+		metadata.Events = append(metadata.Events, &MetadataEvent{
+			Event:  ev,
+			Offset: ev.Time.Sub(startedAt).Milliseconds(),
+		})
+	}
+	for _, c := range conditions {
+		condition := &MetadataCondition{
+			Type:   c.Type,
+			Offset: c.Start.Sub(startedAt).Milliseconds(),
+		}
+		if c.End != nil {
+			end := c.End.Sub(startedAt).Milliseconds()
+			condition.EndOffset = &end
+		}
+		metadata.Conditions = append(metadata.Conditions, condition)
+	}
+
+	b, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	filename := metadataPath(r.filename)
+	if err = os.WriteFile(filename, b, 0644); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+// metadataPath replaces the recording's extension with .json
+func metadataPath(filename string) string {
+	return strings.TrimSuffix(filename, path.Ext(filename)) + ".json"
+}
+
+// saveBrowserLog copies the browser log next to the recording
+func (r *Recorder) saveBrowserLog() error {
+	if r.display == nil {
+		return nil
+	}
+	logFile := r.display.BrowserLog()
+	if logFile == "" {
+		return nil
+	}
+
+	if r.conf.FileOutput.Local {
+		return copyFile(logFile, browserLogPath(r.filename))
+	}
+	logUrl, err := r.upload(logFile, browserLogPath(r.filepath), "application/x-ndjson")
+	if err != nil {
+		return err
+	}
+	r.logger.Infow("browser log uploaded", "url", logUrl)
+	return nil
+}
+
+// browserLogPath replaces the recording's extension with .browser.jsonl
+func browserLogPath(filename string) string {
+	return strings.TrimSuffix(filename, path.Ext(filename)) + ".browser.jsonl"
+}
+
+// withPageError adds the first fatal page error to a failed recording's error. Completed recordings stay completed.
+func withPageError(resultErr, pageErr string) string {
+	if resultErr == "" || pageErr == "" {
+		return resultErr
+	}
+	return fmt.Sprintf("%s (first page error: %s)", resultErr, pageErr)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
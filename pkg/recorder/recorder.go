@@ -1,7 +1,9 @@
 package recorder
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"sync"
 	"time"
 
@@ -9,35 +11,62 @@ import (
 	"github.com/livekit/protocol/logger"
 
 	"github.com/livekit/livekit-recorder/pkg/config"
+	"github.com/livekit/livekit-recorder/pkg/diagnostics"
 	"github.com/livekit/livekit-recorder/pkg/display"
 	"github.com/livekit/livekit-recorder/pkg/pipeline"
+	"github.com/livekit/livekit-recorder/pkg/upload"
 )
 
+const fileSizeInterval = time.Second * 5
+
 type Recorder struct {
 	ID string
 
 	conf     *config.Config
+	logger   logger.Logger          // adds the recording id, and keeps entries in logs
+	logs     *diagnostics.LogBuffer // everything logged for this recording, for its diagnostics bundle
 	req      *livekit.StartRecordingRequest
+	opts     *config.RequestOptions
 	display  *display.Display
 	pipeline *pipeline.Pipeline
 	abort    chan struct{}
+	stopOnce sync.Once
+	done     chan struct{} // closed once run returns, ending its goroutines
 
-	isTemplate bool
-	url        string
-	filename   string
-	filepath   string
+	inputType InputType
+	url       string
+	template  *livekit.RecordingTemplate
+	baseUrl   string
+	filename  string
+	filepath  string
 
 	// result info
-	mu        sync.Mutex
-	result    *livekit.RecordingInfo
-	startedAt map[string]time.Time
+	mu         sync.Mutex
+	result     *livekit.RecordingInfo
+	startedAt  map[string]time.Time
+	stopReason error // limit or policy, kept out of the result
+	failure    error // reported in the result
+	events     []*display.Event
+	conditions []*pipeline.Condition
+
+	// template state, which changes during the recording
+	layout string
+	token  string
+
+	// set while the tab shows a page loaded by a navigate request, instead of the input
+	navigated bool
 }
 
 func NewRecorder(conf *config.Config, recordingID string) *Recorder {
+	logs := diagnostics.NewLogBuffer(diagnostics.LogLines)
 	return &Recorder{
-		ID:    recordingID,
-		conf:  conf,
-		abort: make(chan struct{}),
+		ID:     recordingID,
+		conf:   conf,
+		logger: diagnostics.NewLogger(logs, "recordingID", recordingID),
+		logs:   logs,
+		opts:   &config.RequestOptions{},
+		abort:  make(chan struct{}),
+		done:   make(chan struct{}),
 		result: &livekit.RecordingInfo{
 			Id: recordingID,
 		},
@@ -45,8 +74,21 @@ func NewRecorder(conf *config.Config, recordingID string) *Recorder {
 	}
 }
 
-// Run blocks until completion
+// Run blocks until completion. Failures save a diagnostics bundle, referenced in the result.
 func (r *Recorder) Run() *livekit.RecordingInfo {
+	res := r.run()
+	if res.Error != "" && r.conf.Diagnostics.Enabled {
+		if location, err := r.saveDiagnostics(res); err != nil {
+			r.logger.Errorw("failed to save diagnostics", err)
+		} else {
+			res.Error = fmt.Sprintf("%s (diagnostics: %s)", res.Error, location)
+		}
+	}
+	return res
+}
+
+func (r *Recorder) run() *livekit.RecordingInfo {
+	defer close(r.done)
 	var err error
 
 	// check for request
@@ -55,40 +97,62 @@ func (r *Recorder) Run() *livekit.RecordingInfo {
 		return r.result
 	}
 
-	// launch display
-	r.display, err = display.Launch(r.conf, r.url, r.req.Options, r.isTemplate)
-	if err != nil {
-		logger.Errorw("error launching display", err)
-		r.result.Error = err.Error()
-		return r.result
+	// launch display, only needed when capturing a web page
+	if r.inputType != InputStream && r.conf.Source.Type == config.SourceScreen {
+		r.display, err = display.Launch(r.conf, r.logger, r.ID, r.url, r.req.Options, r.inputType == InputTemplate, r.opts)
+		if err != nil {
+			r.logger.Errorw("error launching display", err)
+			r.result.Error = err.Error()
+			return r.result
+		}
+		go r.handleCrashes(r.display)
+		go r.handleEvents(r.display)
+		if r.inputType == InputTemplate {
+			go r.refreshTokens(r.display)
+		}
 	}
 
 	// create pipeline
 	r.pipeline, err = r.createPipeline(r.req)
 	if err != nil {
-		logger.Errorw("error building pipeline", err)
+		r.logger.Errorw("error building pipeline", err)
 		r.result.Error = err.Error()
 		return r.result
 	}
+	go r.watchContent(r.pipeline)
 
 	// if using template, listen for START_RECORDING and END_RECORDING messages
-	if r.isTemplate {
-		logger.Infow("Waiting for room to start")
+	if r.inputType == InputTemplate && r.display != nil {
+		var startTimeout <-chan time.Time
+		if r.opts.GetStartTimeout() > 0 {
+			timer := time.NewTimer(r.opts.GetStartTimeout())
+			defer timer.Stop()
+			startTimeout = timer.C
+		}
+
+		r.logger.Infow("Waiting for room to start")
 		select {
 		case <-r.display.RoomStarted():
-			logger.Infow("Room started")
+			r.logger.Infow("Room started")
+		case <-startTimeout:
+			r.pipeline.Abort()
+			r.logger.Infow("Room did not start", "timeout", r.opts.GetStartTimeout())
+			r.result.Error = ErrStartTimeout.Error()
+			return r.result
 		case <-r.abort:
 			r.pipeline.Abort()
-			logger.Infow("Recording aborted while waiting for room")
+			r.logger.Infow("Recording aborted while waiting for room")
 			r.result.Error = "Recording aborted"
+			r.mu.Lock()
+			if r.failure != nil {
+				r.result.Error = r.failure.Error()
+			}
+			r.mu.Unlock()
 			return r.result
 		}
 
-		// stop on END_RECORDING console log
-		go func(d *display.Display) {
-			<-d.RoomEnded()
-			r.Stop()
-		}(r.display)
+		// stop once the room has been empty for the grace period
+		go r.watchRoom(r.display)
 	}
 
 	var startedAt time.Time
@@ -105,14 +169,28 @@ func (r *Recorder) Run() *livekit.RecordingInfo {
 		}
 	}()
 
+	// stop once a limit is reached
+	go r.enforceLimits()
+
 	// run pipeline
-	err = r.pipeline.Run()
+	err = r.runPipeline()
 	if err != nil {
-		logger.Errorw("error running pipeline", err)
+		r.logger.Errorw("error running pipeline", err)
 		r.result.Error = err.Error()
 		return r.result
 	}
 
+	// stopped before the pipeline started, so nothing was recorded
+	if r.pipeline.GetStartTime().IsZero() {
+		r.logger.Infow("recording stopped before it started")
+		r.mu.Lock()
+		if r.failure != nil {
+			r.result.Error = r.failure.Error()
+		}
+		r.mu.Unlock()
+		return r.result
+	}
+
 	switch r.req.Output.(type) {
 	case *livekit.StartRecordingRequest_Rtmp:
 		for url, startTime := range r.startedAt {
@@ -125,45 +203,261 @@ func (r *Recorder) Run() *livekit.RecordingInfo {
 		r.result.File = &livekit.FileResult{
 			Duration: time.Since(startedAt).Milliseconds() / 1000,
 		}
-		if r.conf.FileOutput.S3 != nil {
-			if err = r.uploadS3(); err != nil {
-				r.result.Error = err.Error()
-				return r.result
-			}
-			r.result.File.DownloadUrl = fmt.Sprintf("s3://%s/%s", r.conf.FileOutput.S3.Bucket, r.filepath)
-		} else if r.conf.FileOutput.Azblob != nil {
-			if err = r.uploadAzure(); err != nil {
-				r.result.Error = err.Error()
-				return r.result
-			}
-			r.result.File.DownloadUrl = fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s",
-				r.conf.FileOutput.Azblob.AccountName,
-				r.conf.FileOutput.Azblob.ContainerName,
-				r.filepath)
-		} else if r.conf.FileOutput.GCPConfig != nil {
-			if err = r.uploadGCP(); err != nil {
-				r.result.Error = err.Error()
-				return r.result
+
+		metadataFile, err := r.writeMetadata(startedAt)
+		if err != nil {
+			r.logger.Errorw("failed to write metadata", err)
+		}
+
+		r.result.File.DownloadUrl, err = r.upload(r.filename, r.filepath, "video/mp4")
+		if err != nil {
+			r.result.Error = err.Error()
+			return r.result
+		}
+		if metadataFile != "" {
+			if metadataUrl, err := r.upload(metadataFile, metadataPath(r.filepath), "application/json"); err != nil {
+				r.logger.Errorw("failed to upload metadata", err)
+			} else if metadataUrl != "" {
+				r.logger.Infow("metadata uploaded", "url", metadataUrl)
 			}
-			r.result.File.DownloadUrl = fmt.Sprintf("gs://%s/%s", r.conf.FileOutput.GCPConfig.Bucket, r.filepath)
+		}
+		if err = r.saveBrowserLog(); err != nil {
+			r.logger.Errorw("failed to save browser log", err)
 		}
 	}
 
+	r.mu.Lock()
+	if r.failure != nil {
+		r.result.Error = r.failure.Error()
+	} else if r.stopReason != nil {
+		r.logger.Infow("recording stopped", "reason", r.stopReason)
+	}
+	r.mu.Unlock()
+
+	if r.display != nil {
+		pageErr := r.display.PageError()
+		if pageErr != "" && r.result.Error == "" {
+			r.logger.Warnw("recording completed with page error", errors.New(pageErr))
+		}
+		r.result.Error = withPageError(r.result.Error, pageErr)
+	}
+
 	return r.result
 }
 
+// upload copies a local file to its presigned url, if the request options have one, or else to the configured storage,
+// returning its url. Local file output returns an empty url.
+func (r *Recorder) upload(localPath, storagePath, contentType string) (string, error) {
+	var uploader upload.Uploader
+	var err error
+	if len(r.opts.UploadUrls) > 0 {
+		uploader, err = upload.NewPresigned(&r.conf.FileOutput, r.opts.UploadUrls)
+	} else {
+		uploader, err = upload.New(&r.conf.FileOutput)
+	}
+	if err != nil || uploader == nil {
+		return "", err
+	}
+	return uploader.Upload(localPath, storagePath, contentType)
+}
+
 func (r *Recorder) createPipeline(req *livekit.StartRecordingRequest) (*pipeline.Pipeline, error) {
+	src := &pipeline.SourceParams{}
+	if r.inputType == InputStream {
+		src.StreamUrl = r.url
+	}
+	if r.display != nil {
+		src.Display = r.display.Name()
+		src.Frames = r.display.Frames()
+		src.PulseDevice = r.display.PulseMonitor()
+	}
+	if r.opts.Analysis.Enabled() {
+		src.Analysis = &r.opts.Analysis
+	}
+
 	switch output := req.Output.(type) {
 	case *livekit.StartRecordingRequest_Rtmp:
-		return pipeline.NewRtmpPipeline(output.Rtmp.Urls, req.Options)
+		return pipeline.NewRtmpPipeline(r.conf, r.logger, src, output.Rtmp.Urls, req.Options)
 	case *livekit.StartRecordingRequest_Filepath:
-		return pipeline.NewFilePipeline(r.filename, req.Options)
+		return pipeline.NewFilePipeline(r.conf, r.logger, src, r.filename, req.Options)
 	}
 	return nil, ErrNoOutput
 }
 
+// runPipeline blocks until the pipeline completes, or until the shutdown timeout expires after Stop is called.
+// A pipeline which is forced to stop gets the same timeout again, after which it is abandoned.
+func (r *Recorder) runPipeline() error {
+	done := make(chan error, 1)
+	go func() {
+		done <- r.pipeline.Run()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-r.abort:
+	}
+
+	if r.conf.Timeouts.Shutdown <= 0 {
+		return <-done
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(r.conf.Timeouts.Shutdown):
+		r.logger.Infow("pipeline did not stop, forcing it to stop", "timeout", r.conf.Timeouts.Shutdown)
+		r.pipeline.ForceStop()
+	}
+
+	select {
+	case <-done:
+		return ErrShutdownTimeout
+	case <-time.After(r.conf.Timeouts.Shutdown):
+		r.logger.Errorw("pipeline did not stop when forced, abandoning it", ErrPipelineLeaked)
+		return ErrPipelineLeaked
+	}
+}
+
+// enforceLimits stops the recording once it reaches the max duration or max file size,
+// or when free disk space drops below the stop threshold
+func (r *Recorder) enforceLimits() {
+	_, isFile := r.req.Output.(*livekit.StartRecordingRequest_Filepath)
+	if r.opts.GetMaxDuration() <= 0 && !isFile {
+		return
+	}
+
+	startedAt := r.pipeline.GetStartTime()
+	if startedAt.IsZero() {
+		// pipeline never started
+		return
+	}
+
+	var maxDuration <-chan time.Time
+	if r.opts.GetMaxDuration() > 0 {
+		timer := time.NewTimer(r.opts.GetMaxDuration() - time.Since(startedAt))
+		defer timer.Stop()
+		maxDuration = timer.C
+	}
+
+	var checkSize <-chan time.Time
+	if isFile && r.opts.GetMaxFileSize() > 0 {
+		ticker := time.NewTicker(fileSizeInterval)
+		defer ticker.Stop()
+		checkSize = ticker.C
+	}
+
+	var checkDisk <-chan time.Time
+	if isFile {
+		ticker := time.NewTicker(r.conf.DiskSpace.CheckInterval)
+		defer ticker.Stop()
+		checkDisk = ticker.C
+	}
+
+	warned := false
+	for {
+		select {
+		case <-r.abort:
+			return
+		case <-r.done:
+			return
+		case <-maxDuration:
+			r.logger.Infow("max duration reached", "maxDuration", r.opts.GetMaxDuration())
+			r.stopWithReason(ErrMaxDurationReached)
+			return
+		case <-checkSize:
+			info, err := os.Stat(r.filename)
+			if err != nil {
+				continue
+			}
+			if info.Size() >= r.opts.GetMaxFileSize() {
+				r.logger.Infow("max file size reached", "maxFileSize", r.opts.GetMaxFileSize())
+				r.stopWithReason(ErrMaxFileSizeReached)
+				return
+			}
+		case <-checkDisk:
+			free, err := getFreeSpace(r.outputDir())
+			if err != nil {
+				r.logger.Errorw("failed to check disk space", err)
+				continue
+			}
+			if free < uint64(r.conf.DiskSpace.StopThreshold) {
+				r.logger.Errorw("disk space low, stopping recording", ErrDiskSpaceLow, "free", free)
+				r.stopWithReason(ErrDiskSpaceLow)
+				return
+			}
+			if !warned && free < uint64(r.conf.DiskSpace.WarnThreshold) {
+				r.logger.Warnw("disk space low", nil, "free", free)
+				warned = true
+			}
+		}
+	}
+}
+
+// watchRoom stops the recording once everyone has left the room, unless someone rejoins within the grace period
+func (r *Recorder) watchRoom(d *display.Display) {
+	var grace <-chan time.Time
+	var timer *time.Timer
+	for {
+		select {
+		case <-r.abort:
+			return
+		case <-r.done:
+			return
+		case occupied := <-d.RoomOccupied():
+			if occupied {
+				if timer != nil {
+					r.logger.Infow("participant rejoined")
+					timer.Stop()
+					timer, grace = nil, nil
+				}
+				continue
+			}
+			if r.opts.GetEmptyRoomGrace() <= 0 {
+				r.Stop()
+				return
+			}
+			if timer == nil {
+				r.logger.Infow("room empty, waiting for participants", "grace", r.opts.GetEmptyRoomGrace())
+				timer = time.NewTimer(r.opts.GetEmptyRoomGrace())
+				grace = timer.C
+			}
+		case <-grace:
+			r.logger.Infow("room empty, stopping recording")
+			r.Stop()
+			return
+		}
+	}
+}
+
+// handleCrashes reloads the page after a crash until the reload budget is spent, or ends the recording,
+// depending on the configured policy
+func (r *Recorder) handleCrashes(d *display.Display) {
+	reloads := 0
+	for {
+		select {
+		case <-r.abort:
+			return
+		case <-r.done:
+			return
+		case <-d.Crashed():
+			if r.conf.OnCrash.Action == config.CrashReload && reloads < r.conf.OnCrash.MaxReloads {
+				reloads++
+				r.logger.Infow("reloading crashed page", "reload", reloads)
+				err := d.Reload()
+				if err == nil {
+					continue
+				}
+				r.logger.Errorw("failed to reload page", err)
+			}
+			r.fail(ErrBrowserCrashed)
+			return
+		}
+	}
+}
+
 func (r *Recorder) AddOutput(url string) error {
-	logger.Debugw("add output", "url", url)
+	r.logger.Debugw("add output", "url", redactStreamUrl(url))
 	if r.pipeline == nil {
 		return pipeline.ErrPipelineNotFound
 	}
@@ -181,7 +475,7 @@ func (r *Recorder) AddOutput(url string) error {
 }
 
 func (r *Recorder) RemoveOutput(url string) error {
-	logger.Debugw("remove output", "url", url)
+	r.logger.Debugw("remove output", "url", redactStreamUrl(url))
 	if r.pipeline == nil {
 		return pipeline.ErrPipelineNotFound
 	}
@@ -204,16 +498,85 @@ func (r *Recorder) RemoveOutput(url string) error {
 	return nil
 }
 
+// Navigate loads another page in the recorded tab. Outputs keep running while it loads.
+func (r *Recorder) Navigate(url string, readiness *config.Readiness) error {
+	r.logger.Debugw("navigate", "url", display.RedactURL(url))
+	if r.display == nil {
+		return ErrNoPage
+	}
+	if inputType, err := getUrlType(url); err != nil || inputType != InputUrl {
+		return ErrInvalidPageUrl
+	}
+	if readiness != nil {
+		if err := readiness.Validate(); err != nil {
+			return err
+		}
+		// the caller's conditions are left as they were
+		copied := *readiness
+		if copied.Timeout == 0 {
+			copied.Timeout = r.conf.Defaults.Readiness.Timeout
+		}
+		readiness = &copied
+	}
+
+	r.mu.Lock()
+	r.navigated = true
+	r.mu.Unlock()
+
+	return r.display.Navigate(url, readiness)
+}
+
+// Evaluate runs a script in the recorded page, returning its json encoded result
+func (r *Recorder) Evaluate(script string) ([]byte, error) {
+	r.logger.Debugw("evaluate", "length", len(script))
+	if r.display == nil {
+		return nil, ErrNoPage
+	}
+
+	return r.display.Evaluate(script)
+}
+
+// stopWithReason ends a recording which reached a limit. It still succeeds, and the reason goes in its metadata.
+func (r *Recorder) stopWithReason(reason error) {
+	r.mu.Lock()
+	if r.stopReason == nil && r.failure == nil {
+		r.stopReason = reason
+	}
+	r.mu.Unlock()
+
+	r.Stop()
+}
+
+// fail stops the recording, reporting the error in the result
+func (r *Recorder) fail(err error) {
+	r.mu.Lock()
+	if r.stopReason == nil && r.failure == nil {
+		r.failure = err
+	}
+	r.mu.Unlock()
+
+	r.Stop()
+}
+
+// StopReason returns why the recording was stopped early, or an empty string if it wasn't
+func (r *Recorder) StopReason() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopReason == nil {
+		return ""
+	}
+	return r.stopReason.Error()
+}
+
+// Stop can be called more than once, and from any goroutine
 func (r *Recorder) Stop() {
-	select {
-	case <-r.abort:
-		return
-	default:
+	r.stopOnce.Do(func() {
 		close(r.abort)
 		if p := r.pipeline; p != nil {
 			p.Close()
 		}
-	}
+	})
 }
 
 // should only be called after pipeline completes
@@ -6,26 +6,66 @@ import (
 	"net/url"
 	"os"
 	"strings"
-	"time"
 
-	"github.com/livekit/protocol/auth"
 	"github.com/livekit/protocol/livekit"
-	"github.com/livekit/protocol/logger"
-	"github.com/livekit/protocol/utils"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+	"github.com/livekit/livekit-recorder/pkg/display"
+	"github.com/livekit/livekit-recorder/pkg/templates"
+)
+
+type InputType string
+
+const (
+	InputUrl      InputType = "url"
+	InputTemplate InputType = "template"
+	InputStream   InputType = "stream"
 )
 
+// streamSchemes are decoded directly instead of being loaded in chrome
+var streamSchemes = map[string]bool{
+	"rtmp":  true,
+	"rtmps": true,
+	"srt":   true,
+	"rtsp":  true,
+	"rtsps": true,
+}
+
 var (
-	ErrNoOutput        = errors.New("output file, s3 path, or rtmp urls required")
-	ErrInvalidUrl      = errors.New("invalid rtmp url")
-	ErrInvalidFilePath = errors.New("file output must be {path/}filename.mp4")
-	ErrNoInput         = errors.New("input url or template required")
+	ErrNoOutput                = errors.New("output file, s3 path, or rtmp urls required")
+	ErrInvalidUrl              = errors.New("invalid rtmp url")
+	ErrInvalidFilePath         = errors.New("file output must be {path/}filename.mp4")
+	ErrNoInput                 = errors.New("input url or template required")
+	ErrInvalidInput            = errors.New("input url must be http(s), rtmp(s), srt, rtsp(s), or an hls playlist")
+	ErrShutdownTimeout         = errors.New("recorder failed to stop: shutdown timed out, output may be incomplete")
+	ErrPipelineLeaked          = errors.New("recorder failed to stop: pipeline did not stop when forced, and was abandoned")
+	ErrMaxDurationReached      = errors.New("recording stopped: max duration reached")
+	ErrMaxFileSizeReached      = errors.New("recording stopped: max file size reached")
+	ErrDiskSpaceLow            = errors.New("recording stopped: disk space below stop threshold")
+	ErrInsufficientDiskSpace   = errors.New("insufficient disk space")
+	ErrBrowserCrashed          = errors.New("recording stopped: browser crashed")
+	ErrStartTimeout            = errors.New("recording failed: room did not start before start timeout")
+	ErrPageError               = errors.New("recording stopped: page reported an error")
+	ErrNoPage                  = errors.New("recording has no page to control")
+	ErrInvalidPageUrl          = errors.New("page url must be http(s)")
+	ErrTemplateParamNotAllowed = errors.New("template param not allowed")
+	ErrDeadContent             = errors.New("recording stopped: dead content detected")
 )
 
+// SetRequestOptions sets recorder specific options for the next request. Must be called before Validate.
+func (r *Recorder) SetRequestOptions(opts *config.RequestOptions) {
+	r.opts = opts
+}
+
 func (r *Recorder) Validate(req *livekit.StartRecordingRequest) error {
 	r.conf.ApplyDefaults(req)
+	r.conf.ApplyRequestDefaults(r.opts)
+	if _, err := r.conf.Chrome.ProfileDir(r.opts.Page.Profile); err != nil {
+		return err
+	}
 
 	// validate input
-	inputUrl, isTemplate, err := r.GetInputUrl(req)
+	inputUrl, inputType, err := r.GetInputUrl(req)
 	if err != nil {
 		return err
 	}
@@ -65,62 +105,117 @@ func (r *Recorder) Validate(req *livekit.StartRecordingRequest) error {
 			}
 		}
 		r.filepath = filepath
+
+		if err = r.checkDiskSpace(req.Options); err != nil {
+			return err
+		}
 	default:
 		return ErrNoOutput
 	}
 
 	r.req = req
-	r.isTemplate = isTemplate
+	r.inputType = inputType
 	r.url = inputUrl
-	logger.Debugw("request validated", "url", inputUrl)
+	r.logger.Debugw("request validated", "url", display.RedactURL(inputUrl), "inputType", inputType)
 	return nil
 }
 
-func (r *Recorder) GetInputUrl(req *livekit.StartRecordingRequest) (string, bool, error) {
+func (r *Recorder) GetInputUrl(req *livekit.StartRecordingRequest) (string, InputType, error) {
 	switch req.Input.(type) {
 	case *livekit.StartRecordingRequest_Url:
-		return req.Input.(*livekit.StartRecordingRequest_Url).Url, false, nil
+		inputUrl := req.Input.(*livekit.StartRecordingRequest_Url).Url
+		inputType, err := getUrlType(inputUrl)
+		return inputUrl, inputType, err
 	case *livekit.StartRecordingRequest_Template:
 		template := req.Input.(*livekit.StartRecordingRequest_Template).Template
 		if template.RoomName == "" {
-			return "", true, errors.New("room name required for template input")
+			return "", InputTemplate, errors.New("room name required for template input")
+		}
+
+		for key := range r.opts.TemplateParams {
+			if !r.conf.Templates.ParamAllowed(key) {
+				return "", InputTemplate, fmt.Errorf("%w: %s", ErrTemplateParamNotAllowed, key)
+			}
 		}
 
 		r.result.RoomName = template.RoomName
 		token, err := r.buildToken(template.RoomName)
 		if err != nil {
-			return "", true, err
+			return "", InputTemplate, err
 		}
 
-		baseUrl := r.conf.TemplateAddress
-		if template.BaseUrl != "" {
-			baseUrl = template.BaseUrl
+		r.template = template
+		r.layout = template.Layout
+		r.token = token
+		if r.baseUrl, err = r.templateAddress(); err != nil {
+			return "", InputTemplate, err
 		}
+		return r.templateUrl(template.Layout), InputTemplate, nil
+	default:
+		return "", "", ErrNoInput
+	}
+}
 
-		return fmt.Sprintf("%s/%s?url=%s&token=%s",
-			baseUrl, template.Layout, url.QueryEscape(r.conf.WsUrl), token), true, nil
+// getUrlType determines whether a url input is a web page or a media stream
+func getUrlType(inputUrl string) (InputType, error) {
+	u, err := url.Parse(inputUrl)
+	if err != nil {
+		return "", err
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	switch {
+	case streamSchemes[scheme]:
+		return InputStream, nil
+	case scheme == "http" || scheme == "https":
+		if strings.HasSuffix(strings.ToLower(u.Path), ".m3u8") {
+			return InputStream, nil
+		}
+		return InputUrl, nil
+	case scheme == "":
+		// no scheme, left for chrome to resolve
+		return InputUrl, nil
 	default:
-		return "", false, ErrNoInput
+		return "", ErrInvalidInput
 	}
 }
 
-func (r *Recorder) buildToken(roomName string) (string, error) {
-	f := false
-	t := true
-	grant := &auth.VideoGrant{
-		RoomJoin:       true,
-		Room:           roomName,
-		CanSubscribe:   &t,
-		CanPublish:     &f,
-		CanPublishData: &f,
-		Hidden:         true,
-		Recorder:       true,
+// templateAddress returns the request's base url, or the configured template source
+func (r *Recorder) templateAddress() (string, error) {
+	switch {
+	case r.template.BaseUrl != "":
+		return r.template.BaseUrl, nil
+	case r.conf.Templates.Source == config.TemplatesEmbedded:
+		address, err := templates.Serve(r.conf.Templates.Dir)
+		if errors.Is(err, templates.ErrNoTemplates) && r.conf.Templates.Dir == "" {
+			// only release builds embed the templates
+			r.logger.Warnw("no embedded templates, using template_address", err)
+			return r.conf.TemplateAddress, nil
+		}
+		return address, err
+	default:
+		return r.conf.TemplateAddress, nil
 	}
+}
+
+// templateUrl builds the url for a layout, with its default params overridden by the request's
+func (r *Recorder) templateUrl(layout string) string {
+	r.mu.Lock()
+	token := r.token
+	r.mu.Unlock()
 
-	at := auth.NewAccessToken(r.conf.ApiKey, r.conf.ApiSecret).
-		AddGrant(grant).
-		SetIdentity(utils.NewGuid(utils.RecordingPrefix)).
-		SetValidFor(24 * time.Hour)
+	templateUrl := fmt.Sprintf("%s/%s?url=%s&token=%s",
+		r.baseUrl, layout, url.QueryEscape(r.conf.WsUrl), token)
 
-	return at.ToJWT()
+	params := url.Values{}
+	for key, value := range r.conf.Templates.LayoutParams[layout] {
+		params.Set(key, value)
+	}
+	for key, value := range r.opts.TemplateParams {
+		params.Set(key, value)
+	}
+	if len(params) > 0 {
+		templateUrl += "&" + params.Encode()
+	}
+	return templateUrl
 }
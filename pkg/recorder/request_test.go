@@ -1,13 +1,21 @@
 package recorder
 
 import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/livekit/protocol/livekit"
 	"github.com/stretchr/testify/require"
 
 	"github.com/livekit/livekit-recorder/pkg/config"
+	"github.com/livekit/livekit-recorder/pkg/display"
+	"github.com/livekit/livekit-recorder/pkg/pipeline"
 )
 
 func TestInputUrl(t *testing.T) {
@@ -25,9 +33,299 @@ func TestInputUrl(t *testing.T) {
 	require.NoError(t, err)
 	rec := NewRecorder(conf, "fakeRecordingID")
 
-	actual, isTemplate, err := rec.GetInputUrl(req)
+	actual, inputType, err := rec.GetInputUrl(req)
 	require.NoError(t, err)
-	require.True(t, isTemplate)
+	require.Equal(t, InputTemplate, inputType)
 	expected := "https://recorder.livekit.io/#/speaker-light?url=wss%3A%2F%2Ffake.url.io&token="
 	require.True(t, strings.HasPrefix(actual, expected), actual)
+
+	// test builds have no embedded templates
+	conf.Templates.Source = config.TemplatesEmbedded
+	actual, _, err = rec.GetInputUrl(req)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(actual, expected), actual)
+}
+
+func TestTemplateParams(t *testing.T) {
+	req := &livekit.StartRecordingRequest{
+		Input: &livekit.StartRecordingRequest_Template{
+			Template: &livekit.RecordingTemplate{
+				Layout:   "speaker-light",
+				RoomName: "hello",
+			},
+		},
+	}
+
+	conf, err := config.TestConfig()
+	require.NoError(t, err)
+	conf.Templates.AllowedParams = []string{"background", "title"}
+	conf.Templates.LayoutParams = map[string]map[string]string{
+		"speaker-light": {"background": "#ffffff", "title": "Default"},
+	}
+	rec := NewRecorder(conf, "fakeRecordingID")
+	rec.SetRequestOptions(&config.RequestOptions{
+		TemplateParams: map[string]string{"title": "Q&A"},
+	})
+
+	actual, _, err := rec.GetInputUrl(req)
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(actual, "&background=%23ffffff&title=Q%26A"), actual)
+
+	// layout defaults follow layout changes
+	require.True(t, strings.HasSuffix(rec.templateUrl("grid-dark"), "&title=Q%26A"))
+
+	rec.SetRequestOptions(&config.RequestOptions{
+		TemplateParams: map[string]string{"token": "fake"},
+	})
+	_, _, err = rec.GetInputUrl(req)
+	require.ErrorIs(t, err, ErrTemplateParamNotAllowed)
+}
+
+func TestStreamInput(t *testing.T) {
+	conf, err := config.TestConfig()
+	require.NoError(t, err)
+	rec := NewRecorder(conf, "fakeRecordingID")
+
+	for inputUrl, expected := range map[string]InputType{
+		"https://www.livekit.io":                     InputUrl,
+		"rtmp://localhost:1935/live/stream":          InputStream,
+		"srt://localhost:9000":                       InputStream,
+		"https://cdn.example.com/live/playlist.m3u8": InputStream,
+	} {
+		_, inputType, err := rec.GetInputUrl(&livekit.StartRecordingRequest{
+			Input: &livekit.StartRecordingRequest_Url{Url: inputUrl},
+		})
+		require.NoError(t, err)
+		require.Equal(t, expected, inputType, inputUrl)
+	}
+
+	for _, inputUrl := range []string{"ftp://example.com/video.mp4", "file:///etc/passwd"} {
+		_, _, err = rec.GetInputUrl(&livekit.StartRecordingRequest{
+			Input: &livekit.StartRecordingRequest_Url{Url: inputUrl},
+		})
+		require.Equal(t, ErrInvalidInput, err, inputUrl)
+	}
+}
+
+func TestDiskSpace(t *testing.T) {
+	conf, err := config.TestConfig()
+	require.NoError(t, err)
+	rec := NewRecorder(conf, "fakeRecordingID")
+
+	req := &livekit.StartRecordingRequest{
+		Input:  &livekit.StartRecordingRequest_Url{Url: "https://www.livekit.io"},
+		Output: &livekit.StartRecordingRequest_Filepath{Filepath: "test.mp4"},
+	}
+	require.NoError(t, rec.Validate(req))
+
+	// file size limit only
+	maxDuration, maxFileSize := time.Duration(0), int64(1<<62)
+	rec.SetRequestOptions(&config.RequestOptions{MaxDuration: &maxDuration, MaxFileSize: &maxFileSize})
+	require.ErrorIs(t, rec.Validate(req), ErrInsufficientDiskSpace)
+
+	// the smaller of both limits is used
+	maxDuration = time.Second
+	rec.SetRequestOptions(&config.RequestOptions{MaxDuration: &maxDuration, MaxFileSize: &maxFileSize})
+	require.NoError(t, rec.Validate(req))
+
+	conf.DiskSpace.StopThreshold = 1 << 62
+	require.ErrorIs(t, rec.Validate(req), ErrInsufficientDiskSpace)
+}
+
+func TestMetadata(t *testing.T) {
+	conf, err := config.TestConfig()
+	require.NoError(t, err)
+	rec := NewRecorder(conf, "fakeRecordingID")
+	rec.filename = path.Join(t.TempDir(), "recording.mp4")
+
+	startedAt := time.Now()
+	filename, err := rec.writeMetadata(startedAt)
+	require.NoError(t, err)
+	require.Empty(t, filename)
+
+	rec.events = []*display.Event{{
+		Event: display.EventMarker,
+		Label: "Q&A",
+		Time:  startedAt.Add(time.Second * 5),
+	}}
+	filename, err = rec.writeMetadata(startedAt)
+	require.NoError(t, err)
+	require.Equal(t, metadataPath(rec.filename), filename)
+
+	b, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	metadata := &Metadata{}
+	require.NoError(t, json.Unmarshal(b, metadata))
+	require.Len(t, metadata.Events, 1)
+	require.Equal(t, "Q&A", metadata.Events[0].Label)
+	require.Equal(t, int64(5000), metadata.Events[0].Offset)
+	require.Empty(t, metadata.StopReason)
+
+	// limits are recorded in the metadata, not the result
+	rec.stopWithReason(ErrMaxDurationReached)
+	filename, err = rec.writeMetadata(startedAt)
+	require.NoError(t, err)
+	b, err = os.ReadFile(filename)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(b, metadata))
+	require.Equal(t, ErrMaxDurationReached.Error(), metadata.StopReason)
+	require.Nil(t, rec.failure)
+}
+
+func TestTokenValidity(t *testing.T) {
+	conf, err := config.TestConfig()
+	require.NoError(t, err)
+	rec := NewRecorder(conf, "fakeRecordingID")
+	require.Equal(t, defaultTokenValidity, rec.tokenValidity())
+
+	maxDuration, startTimeout := time.Hour*72, time.Minute*10
+	rec.SetRequestOptions(&config.RequestOptions{
+		MaxDuration:  &maxDuration,
+		StartTimeout: &startTimeout,
+	})
+	require.Equal(t, time.Hour*73+time.Minute*10, rec.tokenValidity())
+}
+
+func TestNavigate(t *testing.T) {
+	conf, err := config.TestConfig()
+	require.NoError(t, err)
+	rec := NewRecorder(conf, "fakeRecordingID")
+	rec.display = &display.Display{}
+
+	readiness := &config.Readiness{Selector: "#video"}
+	require.NoError(t, rec.Navigate("https://example.com/outro", readiness))
+	require.Equal(t, time.Duration(0), readiness.Timeout)
+	require.True(t, rec.navigated)
+
+	require.Error(t, rec.Navigate("https://example.com/outro", &config.Readiness{Delay: -time.Second}))
+	require.ErrorIs(t, rec.Navigate("rtmp://example.com/live", nil), ErrInvalidPageUrl)
+}
+
+func TestPageErrorPolicy(t *testing.T) {
+	conf, err := config.TestConfig()
+	require.NoError(t, err)
+	rec := NewRecorder(conf, "fakeRecordingID")
+	require.True(t, rec.endOnPageError())
+
+	// pages loaded by navigate requests are ignored by default
+	rec.navigated = true
+	require.False(t, rec.endOnPageError())
+
+	conf.OnPageError.InitialPageOnly = false
+	require.True(t, rec.endOnPageError())
+
+	conf.OnPageError.Action = config.PageErrorIgnore
+	require.False(t, rec.endOnPageError())
+}
+
+func TestDiagnostics(t *testing.T) {
+	conf, err := config.TestConfig()
+	require.NoError(t, err)
+	conf.Diagnostics = config.Diagnostics{Enabled: true, Path: t.TempDir()}
+	rec := NewRecorder(conf, "fakeRecordingID")
+
+	// not initialized
+	res := rec.Run()
+	bundle := path.Join(conf.Diagnostics.Path, "fakeRecordingID.diagnostics.tar.gz")
+	require.Equal(t, "recorder not initialized (diagnostics: "+bundle+")", res.Error)
+	_, err = os.Stat(bundle)
+	require.NoError(t, err)
+}
+
+func TestRedaction(t *testing.T) {
+	req := redactRequest(&livekit.StartRecordingRequest{
+		Input: &livekit.StartRecordingRequest_Url{
+			Url: "https://example.com/?token=secret",
+		},
+		Output: &livekit.StartRecordingRequest_Rtmp{
+			Rtmp: &livekit.RtmpOutput{Urls: []string{"rtmp://live.twitch.tv/app/stream-key"}},
+		},
+	})
+	require.Equal(t, "https://example.com/?token=redacted", req.Input.(*livekit.StartRecordingRequest_Url).Url)
+	require.Equal(t, []string{"rtmp://live.twitch.tv/app/redacted"}, req.Output.(*livekit.StartRecordingRequest_Rtmp).Rtmp.Urls)
+
+	opts := redactOptions(&config.RequestOptions{
+		Page: config.Page{
+			Headers:   map[string]string{"Authorization": "Bearer secret"},
+			Cookies:   []config.Cookie{{Name: "session", Value: "secret"}},
+			BasicAuth: &config.BasicAuth{Username: "recorder", Password: "secret"},
+		},
+		UploadUrls: map[string]string{"recording.mp4": "https://bucket.s3.amazonaws.com/recording.mp4?X-Amz-Signature=secret"},
+	})
+	require.Equal(t, "redacted", opts.Page.Headers["Authorization"])
+	require.Equal(t, "redacted", opts.Page.Cookies[0].Value)
+	require.Equal(t, "redacted", opts.Page.BasicAuth.Password)
+	require.Equal(t, "redacted", opts.UploadUrls["recording.mp4"])
+
+	lines := redactLines([]string{`adding output {"recordingID": "RE_1", "url": "rtmp://live.twitch.tv/app/stream-key"}`})
+	require.Equal(t, []string{`adding output {"recordingID": "RE_1", "url": "rtmp://live.twitch.tv/app/redacted"}`}, lines)
+}
+
+func TestRecentLogs(t *testing.T) {
+	conf, err := config.TestConfig()
+	require.NoError(t, err)
+	rec := NewRecorder(conf, "fakeRecordingID")
+	other := NewRecorder(conf, "otherRecordingID")
+
+	// the pipeline and display log with the recorder's logger, without adding the id themselves
+	rec.logger.Errorw("pipeline error", errors.New("rtmpsink failed"), "location", "rtmp://live.twitch.tv/app/stream-key")
+	other.logger.Errorw("pipeline error", errors.New("other recording failed"))
+
+	lines := rec.recentLogs()
+	require.Len(t, lines, 1)
+	require.Contains(t, lines[0], "fakeRecordingID")
+	require.Contains(t, lines[0], "rtmpsink failed")
+	require.Contains(t, lines[0], "rtmp://live.twitch.tv/app/redacted")
+	require.NotContains(t, lines[0], "stream-key")
+}
+
+func TestConditions(t *testing.T) {
+	conf, err := config.TestConfig()
+	require.NoError(t, err)
+	rec := NewRecorder(conf, "fakeRecordingID")
+
+	start := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	end := start.Add(time.Minute)
+	rec.addCondition(&pipeline.Condition{Type: pipeline.ConditionBlack, Start: start})
+	rec.addCondition(&pipeline.Condition{Type: pipeline.ConditionSilence, Start: start})
+	rec.addCondition(&pipeline.Condition{Type: pipeline.ConditionBlack, Start: start, End: &end})
+
+	require.Len(t, rec.getConditions(), 2)
+
+	rec.filename = path.Join(t.TempDir(), "recording.mp4")
+	filename, err := rec.writeMetadata(start.Add(-time.Second * 10))
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	metadata := &Metadata{}
+	require.NoError(t, json.Unmarshal(b, metadata))
+	require.Len(t, metadata.Conditions, 2)
+	require.Equal(t, pipeline.ConditionBlack, metadata.Conditions[0].Type)
+	require.Equal(t, int64(10000), metadata.Conditions[0].Offset)
+	require.Equal(t, int64(70000), *metadata.Conditions[0].EndOffset)
+	require.Equal(t, pipeline.ConditionSilence, metadata.Conditions[1].Type)
+	require.Nil(t, metadata.Conditions[1].EndOffset)
+}
+
+func TestConcurrentStop(t *testing.T) {
+	conf, err := config.TestConfig()
+	require.NoError(t, err)
+	rec := NewRecorder(conf, "fakeRecordingID")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec.stopWithReason(ErrMaxDurationReached)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, ErrMaxDurationReached, rec.stopReason)
+	require.Equal(t, ErrMaxDurationReached.Error(), rec.StopReason())
+
+	// the first reason wins
+	rec.fail(ErrBrowserCrashed)
+	require.Nil(t, rec.failure)
 }
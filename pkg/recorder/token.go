@@ -0,0 +1,91 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/livekit/protocol/auth"
+	"github.com/livekit/protocol/utils"
+
+	"github.com/livekit/livekit-recorder/pkg/display"
+)
+
+const (
+	// unlimited recordings get tokens which are refreshed before they expire
+	defaultTokenValidity = time.Hour * 24
+	tokenMargin          = time.Hour
+
+	// pages which support refreshing define this callback, to use the new token if they reconnect or reload
+	refreshTokenScript = `window.livekitRecorderRefreshToken && window.livekitRecorderRefreshToken(%s)`
+)
+
+func (r *Recorder) buildToken(roomName string) (string, error) {
+	f := false
+	t := true
+	grant := &auth.VideoGrant{
+		RoomJoin:       true,
+		Room:           roomName,
+		CanSubscribe:   &t,
+		CanPublish:     &f,
+		CanPublishData: &f,
+		Hidden:         true,
+		Recorder:       true,
+	}
+
+	at := auth.NewAccessToken(r.conf.ApiKey, r.conf.ApiSecret).
+		AddGrant(grant).
+		SetIdentity(utils.NewGuid(r.conf.Participant.IdentityPrefix)).
+		SetMetadata(r.conf.Participant.Metadata).
+		SetValidFor(r.tokenValidity())
+
+	return at.ToJWT()
+}
+
+// tokenValidity covers waiting for the room to start and the max duration, so limited recordings never need a refresh
+func (r *Recorder) tokenValidity() time.Duration {
+	if r.opts.GetMaxDuration() > 0 {
+		return r.opts.GetStartTimeout() + r.opts.GetMaxDuration() + tokenMargin
+	}
+	return defaultTokenValidity
+}
+
+// refreshTokens pushes a new token to the template before the current one expires,
+// and uses it for later reloads and layout changes. Pages loaded by navigate requests are left alone.
+func (r *Recorder) refreshTokens(d *display.Display) {
+	ticker := time.NewTicker(r.tokenValidity() - tokenMargin)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.abort:
+			return
+		case <-r.done:
+			return
+		case <-ticker.C:
+			token, err := r.buildToken(r.template.RoomName)
+			if err != nil {
+				r.logger.Errorw("failed to refresh token", err)
+				continue
+			}
+
+			r.mu.Lock()
+			r.token = token
+			layout := r.layout
+			onTemplate := !r.navigated
+			r.mu.Unlock()
+			if !onTemplate {
+				r.logger.Debugw("token refreshed, page not updated")
+				continue
+			}
+			d.SetUrl(r.templateUrl(layout))
+
+			arg, _ := json.Marshal(token)
+			if _, err = d.Evaluate(fmt.Sprintf(refreshTokenScript, arg)); err != nil {
+				r.logger.Errorw("failed to push refreshed token", err)
+				continue
+			}
+			r.logger.Debugw("token refreshed")
+		}
+	}
+}
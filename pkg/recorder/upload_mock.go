@@ -1,16 +0,0 @@
-//go:build test
-// +build test
-
-package recorder
-
-func (r *Recorder) uploadS3() error {
-	return nil
-}
-
-func (r *Recorder) uploadAzure() error {
-	return nil
-}
-
-func (r *Recorder) uploadGCP() error {
-	return nil
-}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/livekit/protocol/utils"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gopkg.in/yaml.v3"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+)
+
+// Control requests change the page of a running recording. livekit.RecordingRequest has no room for them,
+// so they are sent as structs on their own channels.
+
+const (
+	controlTimeout   = time.Minute
+	controlQueueSize = 16
+)
+
+var (
+	ErrInvalidControlRequest = errors.New("control request must set exactly one of navigate or evaluate")
+	ErrControlTimeout        = errors.New("control request timeout")
+	ErrControlQueueFull      = errors.New("too many pending control requests")
+)
+
+type ControlRequest struct {
+	RequestID string           `yaml:"request_id"`
+	Navigate  *NavigateRequest `yaml:"navigate,omitempty"`
+	Evaluate  *EvaluateRequest `yaml:"evaluate,omitempty"`
+}
+
+// NavigateRequest loads another url in the recorded tab, optionally waiting for it to be ready
+type NavigateRequest struct {
+	Url       string            `yaml:"url"`
+	Readiness *config.Readiness `yaml:"readiness,omitempty"`
+}
+
+// EvaluateRequest runs a script in the recorded page. Promises are awaited.
+type EvaluateRequest struct {
+	Script string `yaml:"script"`
+}
+
+type ControlResponse struct {
+	RequestID string `yaml:"request_id"`
+	Error     string `yaml:"error,omitempty"`
+	Result    string `yaml:"result,omitempty"` // json encoded result of an evaluate request
+}
+
+func ControlChannel(recordingID string) string {
+	return "RECORDING_CONTROL_" + recordingID
+}
+
+func ControlResponseChannel(recordingID string) string {
+	return "RECORDING_CONTROL_RESPONSE_" + recordingID
+}
+
+// Control sends a control request to a running recording, and waits for its response.
+// Navigation can take a while, so the context's deadline is used if it has one.
+func Control(ctx context.Context, bus utils.MessageBus, recordingID string, req *ControlRequest) (*ControlResponse, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, controlTimeout)
+		defer cancel()
+	}
+
+	sub, err := bus.Subscribe(ctx, ControlResponseChannel(recordingID))
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Close()
+
+	if req.RequestID == "" {
+		req.RequestID = utils.NewGuid(utils.RPCPrefix)
+	}
+	msg, err := toStruct(req)
+	if err != nil {
+		return nil, err
+	}
+	if err = bus.Publish(ctx, ControlChannel(recordingID), msg); err != nil {
+		return nil, err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ErrControlTimeout
+		case m := <-sub.Channel():
+			res := &ControlResponse{}
+			if err = readStruct(sub.Payload(m), res); err != nil {
+				return nil, err
+			}
+			if res.RequestID != req.RequestID {
+				continue
+			}
+			if res.Error != "" {
+				return res, errors.New(res.Error)
+			}
+			return res, nil
+		}
+	}
+}
+
+func toStruct(v interface{}) (*structpb.Struct, error) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{})
+	if err = yaml.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return structpb.NewStruct(m)
+}
+
+func readStruct(payload []byte, v interface{}) error {
+	s := &structpb.Struct{}
+	if err := proto.Unmarshal(payload, s); err != nil {
+		return err
+	}
+	b, err := yaml.Marshal(s.AsMap())
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(b, v)
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/livekit/protocol/livekit"
 	"github.com/livekit/protocol/logger"
@@ -12,7 +13,12 @@ import (
 	"github.com/livekit/livekit-recorder/pkg/recorder"
 )
 
-func (s *Service) handleRecording(rec *recorder.Recorder) {
+var (
+	ErrReservationTimeout = errors.New("start request not received before reservation timed out")
+	ErrServiceKilled      = errors.New("service killed before recording started")
+)
+
+func (s *Service) handleRecording(sl *slot, rec *recorder.Recorder) {
 	// subscribe to request channel
 	requests, err := s.bus.Subscribe(s.ctx, recording.RequestChannel(rec.ID))
 	if err != nil {
@@ -20,6 +26,18 @@ func (s *Service) handleRecording(rec *recorder.Recorder) {
 	}
 	defer requests.Close()
 
+	controls, err := s.bus.Subscribe(s.ctx, ControlChannel(rec.ID))
+	if err != nil {
+		return
+	}
+	defer controls.Close()
+
+	options, err := s.bus.Subscribe(s.ctx, OptionsChannel(rec.ID))
+	if err != nil {
+		return
+	}
+	defer options.Close()
+
 	// ready to accept requests
 	err = s.handleResponse(rec.ID, "", nil)
 	if err != nil {
@@ -29,14 +47,46 @@ func (s *Service) handleRecording(rec *recorder.Recorder) {
 	// listen for rpcs
 	logger.Debugw("waiting for requests", "recordingId", rec.ID)
 	result := make(chan *livekit.RecordingInfo, 1)
+	kill := s.kill
+	var optsErr error
+
+	// control requests are handled in order, one at a time. Navigation waits for the page,
+	// so requests and results keep being handled meanwhile.
+	controlQueue := make(chan *ControlRequest, controlQueueSize)
+	defer close(controlQueue)
+	go func() {
+		for req := range controlQueue {
+			s.handleControl(sl, rec, req)
+		}
+	}()
+
+	// give up on the reservation if start never arrives
+	var reservationTimeout <-chan time.Time
+	if s.conf.Timeouts.Reservation > 0 {
+		timer := time.NewTimer(s.conf.Timeouts.Reservation)
+		defer timer.Stop()
+		reservationTimeout = timer.C
+	}
+
 	for {
 		select {
-		case <-s.kill:
+		case <-kill:
 			// kill signal received, stop recorder
-			if status := s.status.Load(); status != Stopping {
-				s.status.Store(Stopping)
+			kill = nil
+			switch sl.status.Load() {
+			case Reserved:
+				abandon(sl, rec, result, ErrServiceKilled)
+			case Stopping:
+			default:
+				sl.status.Store(Stopping)
 				rec.Stop()
 			}
+		case <-reservationTimeout:
+			reservationTimeout = nil
+			if sl.status.Load() == Reserved {
+				logger.Infow("reservation timed out", "recordingId", rec.ID)
+				abandon(sl, rec, result, ErrReservationTimeout)
+			}
 		case res := <-result:
 			// recording stopped, send results to result channel
 			LogResult(res)
@@ -56,24 +106,46 @@ func (s *Service) handleRecording(rec *recorder.Recorder) {
 				continue
 			}
 
-			s.handleRequest(rec, req, result)
+			s.handleRequest(sl, rec, req, result, optsErr)
+		case msg := <-options.Channel():
+			// options are acknowledged, and the start request is only sent after that
+			if err = s.handleOptions(sl, rec, options.Payload(msg)); err != ErrOptionsAfterStart {
+				optsErr = err
+			}
+		case msg := <-controls.Channel():
+			req := &ControlRequest{}
+			if err = readStruct(controls.Payload(msg), req); err != nil {
+				logger.Errorw("failed to read control request", err, "recordingId", rec.ID)
+				continue
+			}
+
+			select {
+			case controlQueue <- req:
+			default:
+				s.publishControlResponse(rec, &ControlResponse{
+					RequestID: req.RequestID,
+					Error:     ErrControlQueueFull.Error(),
+				})
+			}
 		}
 	}
 }
 
-func (s *Service) handleRequest(rec *recorder.Recorder, req *livekit.RecordingRequest, result chan *livekit.RecordingInfo) {
+func (s *Service) handleRequest(sl *slot, rec *recorder.Recorder, req *livekit.RecordingRequest, result chan *livekit.RecordingInfo, optsErr error) {
 	logger.Debugw("handling request", "recordingId", rec.ID, "requestId", req.RequestId)
 	var err error
 	switch req.Request.(type) {
 	case *livekit.RecordingRequest_Start:
-		if status := s.status.Load(); status != Reserved {
+		if status := sl.status.Load(); status != Reserved {
 			err = fmt.Errorf("tried calling start with state %s", status)
 			break
 		}
 
 		// launch recorder
 		start := req.Request.(*livekit.RecordingRequest_Start).Start
-		err = rec.Validate(start)
+		if err = optsErr; err == nil {
+			err = rec.Validate(start)
+		}
 		if err != nil {
 			result <- &livekit.RecordingInfo{
 				Id:    rec.ID,
@@ -82,35 +154,120 @@ func (s *Service) handleRequest(rec *recorder.Recorder, req *livekit.RecordingRe
 			break
 		}
 
-		s.status.Store(Recording)
+		sl.status.Store(Recording)
 		go func() {
 			// blocks until recorder is finished
 			result <- rec.Run()
 		}()
 	case *livekit.RecordingRequest_AddOutput:
-		if status := s.status.Load(); status != Recording {
+		if status := sl.status.Load(); status != Recording {
 			err = fmt.Errorf("tried calling AddOutput with status %s", status)
 			break
 		}
 		err = rec.AddOutput(req.Request.(*livekit.RecordingRequest_AddOutput).AddOutput.RtmpUrl)
 	case *livekit.RecordingRequest_RemoveOutput:
-		if status := s.status.Load(); status != Recording {
+		if status := sl.status.Load(); status != Recording {
 			err = fmt.Errorf("tried calling RemoveOutput with status %s", status)
 			break
 		}
 		err = rec.RemoveOutput(req.Request.(*livekit.RecordingRequest_RemoveOutput).RemoveOutput.RtmpUrl)
 	case *livekit.RecordingRequest_End:
-		if status := s.status.Load(); status != Recording {
+		if status := sl.status.Load(); status != Recording {
 			err = fmt.Errorf("tried calling End with status %s", status)
 			break
 		}
-		s.status.Store(Stopping)
+		sl.status.Store(Stopping)
 		rec.Stop()
 	}
 
 	_ = s.handleResponse(rec.ID, req.RequestId, err)
 }
 
+// handleOptions sets request options for the start request, and acknowledges them.
+// Invalid options are returned, and fail start.
+func (s *Service) handleOptions(sl *slot, rec *recorder.Recorder, payload []byte) error {
+	err := s.setOptions(sl, rec, payload)
+	res := &OptionsResponse{}
+	if err != nil {
+		logger.Errorw("failed to set request options", err, "recordingId", rec.ID)
+		res.Error = err.Error()
+	}
+	s.publishOptionsResponse(rec, res)
+	return err
+}
+
+func (s *Service) setOptions(sl *slot, rec *recorder.Recorder, payload []byte) error {
+	if sl.status.Load() != Reserved {
+		return ErrOptionsAfterStart
+	}
+	opts, err := readOptions(payload)
+	if err != nil {
+		return err
+	}
+	rec.SetRequestOptions(opts)
+	return nil
+}
+
+func (s *Service) handleControl(sl *slot, rec *recorder.Recorder, req *ControlRequest) {
+	logger.Debugw("handling control request", "recordingId", rec.ID, "requestId", req.RequestID)
+	res := &ControlResponse{RequestID: req.RequestID}
+	var err error
+	switch {
+	case sl.status.Load() != Recording:
+		err = fmt.Errorf("tried calling control with status %s", sl.status.Load())
+	case (req.Navigate == nil) == (req.Evaluate == nil):
+		err = ErrInvalidControlRequest
+	case req.Navigate != nil:
+		err = rec.Navigate(req.Navigate.Url, req.Navigate.Readiness)
+	default:
+		var result []byte
+		result, err = rec.Evaluate(req.Evaluate.Script)
+		res.Result = string(result)
+	}
+
+	if err != nil {
+		logger.Errorw("error handling control request", err,
+			"recordingId", rec.ID, "requestId", req.RequestID)
+		res.Error = err.Error()
+	}
+	s.publishControlResponse(rec, res)
+}
+
+func (s *Service) publishControlResponse(rec *recorder.Recorder, res *ControlResponse) {
+	msg, err := toStruct(res)
+	if err != nil {
+		logger.Errorw("failed to write control response", err, "recordingId", rec.ID)
+		return
+	}
+	if err = s.bus.Publish(s.ctx, ControlResponseChannel(rec.ID), msg); err != nil {
+		logger.Errorw("failed to write control response", err, "recordingId", rec.ID)
+	}
+}
+
+func (s *Service) publishOptionsResponse(rec *recorder.Recorder, res *OptionsResponse) {
+	msg, err := toStruct(res)
+	if err != nil {
+		logger.Errorw("failed to write options response", err, "recordingId", rec.ID)
+		return
+	}
+	if err = s.bus.Publish(s.ctx, OptionsResponseChannel(rec.ID), msg); err != nil {
+		logger.Errorw("failed to write options response", err, "recordingId", rec.ID)
+	}
+}
+
+// abandon ends a recording which was never started, so a late start request is rejected
+func abandon(sl *slot, rec *recorder.Recorder, result chan *livekit.RecordingInfo, err error) {
+	sl.status.Store(Stopping)
+	select {
+	case result <- &livekit.RecordingInfo{
+		Id:    rec.ID,
+		Error: err.Error(),
+	}:
+	default:
+		// a result is already pending
+	}
+}
+
 func (s *Service) handleResponse(recordingId, requestId string, err error) error {
 	var message string
 	if err != nil {
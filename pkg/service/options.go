@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/livekit/protocol/utils"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gopkg.in/yaml.v3"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+)
+
+// Request options have no room in livekit.StartRecordingRequest either. They are sent on the recording's
+// options channel after it has been reserved, and the recorder acknowledges them before the start request is sent,
+// since messages on different channels can arrive out of order.
+
+const optionsTimeout = time.Second * 10
+
+var (
+	ErrOptionsTimeout    = errors.New("request options not acknowledged")
+	ErrOptionsAfterStart = errors.New("request options must be set before the start request")
+)
+
+type OptionsResponse struct {
+	Error string `yaml:"error,omitempty"`
+}
+
+func OptionsChannel(recordingID string) string {
+	return "RECORDING_OPTIONS_" + recordingID
+}
+
+func OptionsResponseChannel(recordingID string) string {
+	return "RECORDING_OPTIONS_RESPONSE_" + recordingID
+}
+
+// SetOptions sends request options to a reserved recorder, and waits until they have been applied.
+// The start request must only be sent once it returns without error.
+func SetOptions(ctx context.Context, bus utils.MessageBus, recordingID string, opts *config.RequestOptions) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, optionsTimeout)
+		defer cancel()
+	}
+
+	sub, err := bus.Subscribe(ctx, OptionsResponseChannel(recordingID))
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	msg, err := toStruct(opts)
+	if err != nil {
+		return err
+	}
+	if err = bus.Publish(ctx, OptionsChannel(recordingID), msg); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ErrOptionsTimeout
+	case m := <-sub.Channel():
+		res := &OptionsResponse{}
+		if err = readStruct(sub.Payload(m), res); err != nil {
+			return err
+		}
+		if res.Error != "" {
+			return errors.New(res.Error)
+		}
+		return nil
+	}
+}
+
+// readOptions parses and validates options the same way as the standalone recorder
+func readOptions(payload []byte) (*config.RequestOptions, error) {
+	s := &structpb.Struct{}
+	if err := proto.Unmarshal(payload, s); err != nil {
+		return nil, err
+	}
+	b, err := yaml.Marshal(s.AsMap())
+	if err != nil {
+		return nil, err
+	}
+	return config.NewRequestOptions(string(b))
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -19,9 +20,13 @@ type Service struct {
 	ctx      context.Context
 	conf     *config.Config
 	bus      utils.MessageBus
-	status   atomic.Value // Status
+	running  atomic.Value // bool
+	slots    []*slot
+	free     chan *slot
+	wg       sync.WaitGroup
 	shutdown chan struct{}
 	kill     chan struct{}
+	killOnce sync.Once
 }
 
 type Status string
@@ -34,21 +39,39 @@ const (
 	Stopping  Status = "stopping"
 )
 
+// slot runs a single recording at a time
+type slot struct {
+	status      atomic.Value // Status
+	recordingID atomic.Value // string
+}
+
+type SlotStatus struct {
+	Status      Status `json:"status"`
+	RecordingID string `json:"recording_id,omitempty"`
+}
+
 func NewService(conf *config.Config, bus utils.MessageBus) *Service {
 	s := &Service{
 		ctx:      context.Background(),
 		conf:     conf,
 		bus:      bus,
-		status:   atomic.Value{},
+		slots:    make([]*slot, conf.Capacity),
+		free:     make(chan *slot, conf.Capacity),
 		shutdown: make(chan struct{}, 1),
-		kill:     make(chan struct{}, 1),
+		kill:     make(chan struct{}),
+	}
+	s.running.Store(false)
+	for i := range s.slots {
+		sl := &slot{}
+		sl.release()
+		s.slots[i] = sl
+		s.free <- sl
 	}
-	s.status.Store(Starting)
 	return s
 }
 
 func (s *Service) Run() error {
-	logger.Debugw("starting service")
+	logger.Debugw("starting service", "capacity", len(s.slots))
 
 	reservations, err := s.bus.SubscribeQueue(context.Background(), recording.ReservationChannel)
 	if err != nil {
@@ -56,14 +79,21 @@ func (s *Service) Run() error {
 	}
 	defer reservations.Close()
 
+	s.running.Store(true)
 	for {
-		s.status.Store(Available)
+		// only accept reservations while a slot is free
+		var sl *slot
+		select {
+		case <-s.shutdown:
+			return s.finish()
+		case sl = <-s.free:
+		}
 		logger.Debugw("recorder waiting")
 
 		select {
 		case <-s.shutdown:
-			logger.Infow("shutting down")
-			return nil
+			s.free <- sl
+			return s.finish()
 		case msg := <-reservations.Channel():
 			logger.Debugw("request received")
 
@@ -71,30 +101,85 @@ func (s *Service) Run() error {
 			err := proto.Unmarshal(reservations.Payload(msg), req)
 			if err != nil {
 				logger.Errorw("malformed request", err)
+				s.free <- sl
 				continue
 			}
 
 			if req.SubmittedAt < time.Now().Add(-recording.ReservationTimeout).UnixNano()/1e6 {
 				logger.Debugw("discarding old request", "ID", req.Id)
+				s.free <- sl
 				continue
 			}
 
-			s.status.Store(Reserved)
+			sl.reserve(req.Id)
 			logger.Debugw("request claimed", "ID", req.Id)
 
-			// handleRecording blocks until recording is finished
-			s.handleRecording(recorder.NewRecorder(s.conf, req.Id))
+			s.wg.Add(1)
+			go func(sl *slot, rec *recorder.Recorder) {
+				defer s.wg.Done()
+
+				// handleRecording blocks until recording is finished
+				s.handleRecording(sl, rec)
+				sl.release()
+				s.free <- sl
+			}(sl, recorder.NewRecorder(s.conf, req.Id))
 		}
 	}
 }
 
+// finish waits for active recordings to complete
+func (s *Service) finish() error {
+	logger.Infow("shutting down")
+	s.wg.Wait()
+	return nil
+}
+
+// Status returns the most available state of any slot
 func (s *Service) Status() Status {
-	return s.status.Load().(Status)
+	if !s.running.Load().(bool) {
+		return Starting
+	}
+
+	statuses := make(map[Status]bool)
+	for _, sl := range s.slots {
+		statuses[sl.status.Load().(Status)] = true
+	}
+	for _, status := range []Status{Available, Reserved, Recording, Stopping} {
+		if statuses[status] {
+			return status
+		}
+	}
+	return Stopping
+}
+
+// SlotStatus returns the state of each slot
+func (s *Service) SlotStatus() []SlotStatus {
+	res := make([]SlotStatus, 0, len(s.slots))
+	for _, sl := range s.slots {
+		res = append(res, SlotStatus{
+			Status:      sl.status.Load().(Status),
+			RecordingID: sl.recordingID.Load().(string),
+		})
+	}
+	return res
 }
 
 func (s *Service) Stop(kill bool) {
-	s.shutdown <- struct{}{}
+	select {
+	case s.shutdown <- struct{}{}:
+	default:
+	}
 	if kill {
-		s.kill <- struct{}{}
+		s.killOnce.Do(func() { close(s.kill) })
 	}
 }
+
+func (sl *slot) reserve(recordingID string) {
+	sl.recordingID.Store(recordingID)
+	sl.status.Store(Reserved)
+}
+
+func (sl *slot) release() {
+	sl.recordingID.Store("")
+	sl.status.Store(Available)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/livekit/protocol/recording"
 	"github.com/livekit/protocol/utils"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/livekit/livekit-recorder/pkg/config"
 	"github.com/livekit/livekit-recorder/pkg/messaging"
@@ -18,6 +19,7 @@ import (
 func TestService(t *testing.T) {
 	conf, err := config.TestConfig()
 	require.NoError(t, err)
+	conf.Timeouts.Reservation = time.Second * 5
 
 	bus, err := messaging.NewMessageBus(conf)
 	require.NoError(t, err)
@@ -105,12 +107,17 @@ func TestService(t *testing.T) {
 	if !t.Run("RPCs", func(t *testing.T) {
 		id2, err = recording.ReserveRecorder(bus)
 		require.NoError(t, err)
+		maxDuration := time.Duration(0)
+		require.NoError(t, SetOptions(context.Background(), bus, id2, &config.RequestOptions{
+			MaxDuration: &maxDuration,
+		}))
 		require.NoError(t, recording.RPC(context.Background(), bus, id2, &livekit.RecordingRequest{
 			RequestId: utils.RandomSecret(),
 			Request: &livekit.RecordingRequest_Start{
 				Start: startRecordingRequest(false),
 			},
 		}))
+		require.EqualError(t, SetOptions(context.Background(), bus, id2, &config.RequestOptions{}), ErrOptionsAfterStart.Error())
 
 		require.NoError(t, recording.RPC(context.Background(), bus, id2, &livekit.RecordingRequest{
 			RequestId: utils.RandomSecret(),
@@ -121,6 +128,28 @@ func TestService(t *testing.T) {
 				},
 			},
 		}))
+
+		_, err = Control(context.Background(), bus, id2, &ControlRequest{
+			Navigate: &NavigateRequest{Url: "https://example.com/outro"},
+		})
+		require.NoError(t, err)
+
+		res, err := Control(context.Background(), bus, id2, &ControlRequest{
+			Evaluate: &EvaluateRequest{Script: "document.title"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "null", res.Result)
+
+		_, err = Control(context.Background(), bus, id2, &ControlRequest{
+			Navigate: &NavigateRequest{
+				Url:       "https://example.com/outro",
+				Readiness: &config.Readiness{Delay: -time.Second},
+			},
+		})
+		require.Error(t, err)
+
+		_, err = Control(context.Background(), bus, id2, &ControlRequest{})
+		require.Error(t, err)
 	}) {
 		t.FailNow()
 	}
@@ -140,7 +169,10 @@ func TestService(t *testing.T) {
 		t.FailNow()
 	}
 
-	if !t.Run("Kill service", func(t *testing.T) {
+	if !t.Run("Start recording before kill", func(t *testing.T) {
+		time.Sleep(time.Millisecond * 100)
+		require.Equal(t, Available, svc.Status())
+
 		id3, err = recording.ReserveRecorder(bus)
 		require.NoError(t, err)
 		require.NoError(t, recording.RPC(context.Background(), bus, id3, &livekit.RecordingRequest{
@@ -149,7 +181,34 @@ func TestService(t *testing.T) {
 				Start: startRecordingRequest(false),
 			},
 		}))
+	}) {
+		t.FailNow()
+	}
+
+	if !t.Run("Reservation timeout", func(t *testing.T) {
+		// svc is busy, so the reservation goes to a service of its own
+		timeoutConf, err := config.TestConfig()
+		require.NoError(t, err)
+		timeoutConf.Timeouts.Reservation = time.Millisecond * 100
 
+		timeoutSvc := NewService(timeoutConf, bus)
+		go func() {
+			require.NoError(t, timeoutSvc.Run())
+		}()
+		defer timeoutSvc.Stop(false)
+		time.Sleep(time.Millisecond * 100)
+
+		_, err = recording.ReserveRecorder(bus)
+		require.NoError(t, err)
+		require.Equal(t, Reserved, timeoutSvc.Status())
+
+		time.Sleep(time.Millisecond * 200)
+		require.Equal(t, Available, timeoutSvc.Status())
+	}) {
+		t.FailNow()
+	}
+
+	if !t.Run("Kill service", func(t *testing.T) {
 		svc.Stop(true)
 		time.Sleep(time.Millisecond * 100)
 		status := svc.Status()
@@ -160,6 +219,32 @@ func TestService(t *testing.T) {
 	}
 }
 
+func TestOptions(t *testing.T) {
+	maxDuration := time.Duration(0)
+	msg, err := toStruct(&config.RequestOptions{
+		MaxDuration:    &maxDuration,
+		TemplateParams: map[string]string{"title": "Q&A"},
+	})
+	require.NoError(t, err)
+	payload, err := proto.Marshal(msg)
+	require.NoError(t, err)
+
+	opts, err := readOptions(payload)
+	require.NoError(t, err)
+	require.NotNil(t, opts.MaxDuration)
+	require.Equal(t, time.Duration(0), *opts.MaxDuration)
+	require.Nil(t, opts.MaxFileSize)
+	require.Equal(t, "Q&A", opts.TemplateParams["title"])
+
+	maxDuration = -time.Second
+	msg, err = toStruct(&config.RequestOptions{MaxDuration: &maxDuration})
+	require.NoError(t, err)
+	payload, err = proto.Marshal(msg)
+	require.NoError(t, err)
+	_, err = readOptions(payload)
+	require.Error(t, err)
+}
+
 func startRecordingRequest(s3 bool) *livekit.StartRecordingRequest {
 	req := &livekit.StartRecordingRequest{
 		Input: &livekit.StartRecordingRequest_Template{Template: &livekit.RecordingTemplate{
@@ -0,0 +1,95 @@
+package templates
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/livekit/protocol/logger"
+)
+
+//go:embed build
+var embedded embed.FS
+
+var ErrNoTemplates = errors.New("no templates found: copy the web build into pkg/templates/build, set templates.dir, or use remote templates")
+
+var servers = struct {
+	mu        sync.Mutex
+	addresses map[string]string
+}{addresses: make(map[string]string)}
+
+// Serve starts a loopback server for the built-in templates, with custom layouts in dir overriding them.
+// Recordings using the same dir share a server. Failures are not kept, so the next recording tries again.
+func Serve(dir string) (string, error) {
+	servers.mu.Lock()
+	defer servers.mu.Unlock()
+
+	if address, ok := servers.addresses[dir]; ok {
+		return address, nil
+	}
+	address, err := listen(dir)
+	if err != nil {
+		return "", err
+	}
+	servers.addresses[dir] = address
+	return address, nil
+}
+
+// listen serves the templates on a random local port, returning the template address
+func listen(dir string) (string, error) {
+	files, err := templateFS(dir)
+	if err != nil {
+		return "", err
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	go func() {
+		if err := http.Serve(ln, http.FileServer(http.FS(files))); err != nil {
+			logger.Errorw("template server stopped", err)
+		}
+	}()
+
+	// layouts are routed by the url fragment
+	address := fmt.Sprintf("http://%s/#", ln.Addr().String())
+	logger.Debugw("serving templates", "address", address, "dir", dir)
+	return address, nil
+}
+
+func templateFS(dir string) (fs.FS, error) {
+	built, err := fs.Sub(embedded, "build")
+	if err != nil {
+		return nil, err
+	}
+
+	files := overlay{}
+	if dir != "" {
+		files = append(files, os.DirFS(dir))
+	}
+	files = append(files, built)
+
+	if _, err = fs.Stat(files, "index.html"); err != nil {
+		return nil, ErrNoTemplates
+	}
+	return files, nil
+}
+
+// overlay opens files from the first file system which has them
+type overlay []fs.FS
+
+func (o overlay) Open(name string) (fs.File, error) {
+	for _, fsys := range o {
+		f, err := fsys.Open(name)
+		if err == nil || !errors.Is(err, fs.ErrNotExist) {
+			return f, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
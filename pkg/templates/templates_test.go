@@ -0,0 +1,72 @@
+package templates
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateFS(t *testing.T) {
+	// only the placeholder is embedded outside of release builds
+	_, err := templateFS("")
+	require.ErrorIs(t, err, ErrNoTemplates)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(dir, "index.html"), []byte("custom"), 0644))
+
+	files, err := templateFS(dir)
+	require.NoError(t, err)
+	b, err := fs.ReadFile(files, "index.html")
+	require.NoError(t, err)
+	require.Equal(t, "custom", string(b))
+
+	// built-in files are still available
+	_, err = fs.Stat(files, "README.md")
+	require.NoError(t, err)
+	_, err = fs.Stat(files, "missing.js")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestListen(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(dir, "index.html"), []byte("custom"), 0644))
+
+	address, err := listen(dir)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(address, "http://127.0.0.1:"))
+	require.True(t, strings.HasSuffix(address, "/#"))
+
+	res, err := http.Get(strings.TrimSuffix(address, "#"))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, "custom", string(b))
+}
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+	_, err := Serve(dir)
+	require.ErrorIs(t, err, ErrNoTemplates)
+
+	// tried again once the templates exist
+	require.NoError(t, os.WriteFile(path.Join(dir, "index.html"), []byte("custom"), 0644))
+	address, err := Serve(dir)
+	require.NoError(t, err)
+	again, err := Serve(dir)
+	require.NoError(t, err)
+	require.Equal(t, address, again)
+
+	// other dirs get their own server
+	other := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(other, "index.html"), []byte("other"), 0644))
+	otherAddress, err := Serve(other)
+	require.NoError(t, err)
+	require.NotEqual(t, address, otherAddress)
+}
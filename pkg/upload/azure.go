@@ -0,0 +1,68 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+)
+
+func init() {
+	register("azblob",
+		func(conf *config.FileOutput) bool { return conf.Azblob != nil },
+		func(conf *config.FileOutput) (Uploader, error) { return &azureUploader{conf: conf.Azblob}, nil },
+	)
+}
+
+type azureUploader struct {
+	conf *config.AzblobConfig
+}
+
+func (u *azureUploader) Upload(localPath, storagePath, contentType string) (string, error) {
+	credential, err := azblob.NewSharedKeyCredential(
+		u.conf.AccountName,
+		u.conf.AccountKey,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	p := azblob.NewPipeline(credential, azblob.PipelineOptions{})
+
+	URL, _ := url.Parse(
+		fmt.Sprintf("https://%s.blob.core.windows.net/%s",
+			u.conf.AccountName,
+			u.conf.ContainerName,
+		),
+	)
+
+	containerURL := azblob.NewContainerURL(*URL, p)
+
+	blobURL := containerURL.NewBlockBlobURL(storagePath)
+	file, err := os.Open(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// upload blocks in parallel for optimal performance
+	// it calls PutBlock/PutBlockList for files larger than 256 MBs and PutBlob for smaller files
+	ctx := context.Background()
+	_, err = azblob.UploadFileToBlockBlob(ctx, file, blobURL, azblob.UploadToBlockBlobOptions{
+		BlobHTTPHeaders: azblob.BlobHTTPHeaders{ContentType: contentType},
+		BlockSize:       4 * 1024 * 1024,
+		Parallelism:     16,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s",
+		u.conf.AccountName,
+		u.conf.ContainerName,
+		storagePath), nil
+}
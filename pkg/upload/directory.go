@@ -0,0 +1,39 @@
+package upload
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+)
+
+func init() {
+	register("directory",
+		func(conf *config.FileOutput) bool { return conf.Directory != nil },
+		func(conf *config.FileOutput) (Uploader, error) {
+			return &directoryUploader{dir: conf.Directory.Path}, nil
+		},
+	)
+}
+
+// directoryUploader moves files into a directory, such as an nfs mount
+type directoryUploader struct {
+	dir string
+}
+
+func (u *directoryUploader) Upload(localPath, storagePath, _ string) (string, error) {
+	dst := filepath.Join(u.dir, filepath.FromSlash(storagePath))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(localPath, dst); err != nil {
+		// mounts are usually on another device
+		if err = copyFile(localPath, dst); err != nil {
+			_ = os.Remove(dst)
+			return "", err
+		}
+		_ = os.Remove(localPath)
+	}
+	return dst, nil
+}
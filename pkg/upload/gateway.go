@@ -0,0 +1,74 @@
+package upload
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+)
+
+func init() {
+	register("gateway",
+		func(conf *config.FileOutput) bool { return conf.Gateway != nil },
+		func(conf *config.FileOutput) (Uploader, error) {
+			return &gatewayUploader{conf: conf.Gateway, client: newClient(conf.Gateway.Timeout)}, nil
+		},
+	)
+}
+
+// gatewayUploader puts each file to a url built from the storage path. The gateway stores it wherever it likes.
+type gatewayUploader struct {
+	conf   *config.GatewayConfig
+	client *http.Client
+}
+
+func (u *gatewayUploader) Upload(localPath, storagePath, contentType string) (string, error) {
+	location := strings.ReplaceAll(u.conf.Url, "{path}", escapePath(storagePath))
+	if err := put(u.client, location, localPath, contentType, func(req *http.Request) {
+		for name, value := range u.conf.Headers {
+			req.Header.Set(name, value)
+		}
+	}); err != nil {
+		return "", err
+	}
+	return stripSecrets(location), nil
+}
+
+// NewPresigned returns an uploader which puts files to the presigned urls given for a recording, by storage path.
+// Other files, such as diagnostics, go to the configured storage, if any.
+func NewPresigned(conf *config.FileOutput, urls map[string]string) (Uploader, error) {
+	fallback, err := New(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	var timeout time.Duration
+	if conf.Gateway != nil {
+		timeout = conf.Gateway.Timeout
+	}
+	return &presignedUploader{urls: urls, client: newClient(timeout), fallback: fallback}, nil
+}
+
+// presignedUploader puts each file to its own url. The signature may cover the content type, so urls must be
+// signed for the one uploaded.
+type presignedUploader struct {
+	urls     map[string]string
+	client   *http.Client
+	fallback Uploader
+}
+
+func (u *presignedUploader) Upload(localPath, storagePath, contentType string) (string, error) {
+	location, ok := u.urls[storagePath]
+	if !ok {
+		if u.fallback == nil {
+			return "", nil
+		}
+		return u.fallback.Upload(localPath, storagePath, contentType)
+	}
+
+	if err := put(u.client, location, localPath, contentType, nil); err != nil {
+		return "", err
+	}
+	return stripSecrets(location), nil
+}
@@ -0,0 +1,50 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+)
+
+func init() {
+	register("gcp",
+		func(conf *config.FileOutput) bool { return conf.GCPConfig != nil },
+		func(conf *config.FileOutput) (Uploader, error) { return &gcpUploader{conf: conf.GCPConfig}, nil },
+	)
+}
+
+type gcpUploader struct {
+	conf *config.GCPConfig
+}
+
+func (u *gcpUploader) Upload(localPath, storagePath, contentType string) (string, error) {
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	wc := client.Bucket(u.conf.Bucket).Object(storagePath).NewWriter(ctx)
+	wc.ContentType = contentType
+
+	if _, err = io.Copy(wc, file); err != nil {
+		return "", fmt.Errorf("io.Copy: %v", err)
+	}
+
+	if err = wc.Close(); err != nil {
+		return "", fmt.Errorf("Writer.Close: %v", err)
+	}
+	return fmt.Sprintf("gs://%s/%s", u.conf.Bucket, storagePath), nil
+}
@@ -0,0 +1,74 @@
+package upload
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultTimeout bounds a whole request, including sending the file, when the config sets no timeout
+const defaultTimeout = time.Hour
+
+func newClient(timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+// put uploads a file with a PUT request
+func put(client *http.Client, location, localPath, contentType string, prepare func(*http.Request)) error {
+	file, size, err := openFile(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	req, err := http.NewRequest(http.MethodPut, location, file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	if prepare != nil {
+		prepare(req)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		// client errors include the url, along with any signature
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = stripSecrets(location)
+		}
+		return err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return statusError(http.MethodPut, stripSecrets(location), res.Status)
+	}
+	return nil
+}
+
+// escapePath escapes each segment of a storage path
+func escapePath(storagePath string) string {
+	segments := strings.Split(storagePath, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// stripSecrets removes credentials and query params, such as presigned signatures, from a location
+func stripSecrets(location string) string {
+	u, err := url.Parse(location)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
@@ -0,0 +1,57 @@
+package upload
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+)
+
+func init() {
+	register("s3",
+		func(conf *config.FileOutput) bool { return conf.S3 != nil },
+		func(conf *config.FileOutput) (Uploader, error) { return &s3Uploader{conf: conf.S3}, nil },
+	)
+}
+
+type s3Uploader struct {
+	conf *config.S3Config
+}
+
+func (u *s3Uploader) Upload(localPath, storagePath, contentType string) (string, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials(
+			u.conf.AccessKey,
+			u.conf.Secret,
+			"",
+		),
+		Endpoint: aws.String(u.conf.Endpoint),
+		Region:   aws.String(u.conf.Region),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	file, size, err := openFile(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	_, err = s3.New(sess).PutObject(&s3.PutObjectInput{
+		Bucket:        aws.String(u.conf.Bucket),
+		Key:           aws.String(storagePath),
+		Body:          file,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String(contentType),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("s3://%s/%s", u.conf.Bucket, storagePath), nil
+}
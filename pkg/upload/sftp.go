@@ -0,0 +1,130 @@
+package upload
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+)
+
+// sftpConnectTimeout bounds connecting to the server, within the upload timeout
+const sftpConnectTimeout = time.Second * 30
+
+func init() {
+	register("sftp",
+		func(conf *config.FileOutput) bool { return conf.SFTP != nil },
+		newSFTPUploader,
+	)
+}
+
+type sftpUploader struct {
+	conf      *config.SFTPConfig
+	sshConfig *ssh.ClientConfig
+	timeout   time.Duration
+}
+
+func newSFTPUploader(conf *config.FileOutput) (Uploader, error) {
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(conf.SFTP.HostKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid sftp host_key: %v", err)
+	}
+
+	var auth []ssh.AuthMethod
+	if conf.SFTP.PrivateKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(conf.SFTP.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid sftp private_key: %v", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if conf.SFTP.Password != "" {
+		auth = append(auth, ssh.Password(conf.SFTP.Password))
+	}
+
+	timeout := conf.SFTP.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	return &sftpUploader{
+		conf: conf.SFTP,
+		sshConfig: &ssh.ClientConfig{
+			User:            conf.SFTP.Username,
+			Auth:            auth,
+			HostKeyCallback: ssh.FixedHostKey(hostKey),
+			Timeout:         sftpConnectTimeout,
+		},
+		timeout: timeout,
+	}, nil
+}
+
+func (u *sftpUploader) Upload(localPath, storagePath, _ string) (string, error) {
+	conn, err := u.dial()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	remotePath := storagePath
+	if u.conf.Dir != "" {
+		remotePath = path.Join(u.conf.Dir, storagePath)
+	}
+	if dir := path.Dir(remotePath); dir != "." {
+		if err = client.MkdirAll(dir); err != nil {
+			return "", err
+		}
+	}
+
+	file, _, err := openFile(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	remote, err := client.Create(remotePath)
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(remote, file); err != nil {
+		_ = remote.Close()
+		return "", err
+	}
+	if err = remote.Close(); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("sftp://%s@%s/%s", u.conf.Username, u.conf.Address, strings.TrimPrefix(remotePath, "/")), nil
+}
+
+// dial connects to the server. The deadline covers the handshake and the whole transfer, so a stalled server fails
+// the upload instead of blocking it.
+func (u *sftpUploader) dial() (*ssh.Client, error) {
+	netConn, err := net.DialTimeout("tcp", u.conf.Address, u.sshConfig.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if err = netConn.SetDeadline(time.Now().Add(u.timeout)); err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(netConn, u.conf.Address, u.sshConfig)
+	if err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
@@ -0,0 +1,92 @@
+package upload
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+)
+
+var (
+	ErrMultipleStorage = errors.New("only one file_output storage can be set")
+	ErrUploadFailed    = errors.New("upload failed")
+)
+
+// Uploader copies a local file to storage, returning its location
+type Uploader interface {
+	Upload(localPath, storagePath, contentType string) (string, error)
+}
+
+// backend is a storage which can be set in config.FileOutput
+type backend struct {
+	name       string
+	configured func(conf *config.FileOutput) bool
+	create     func(conf *config.FileOutput) (Uploader, error)
+}
+
+var backends []*backend
+
+// register adds a backend. Backends register themselves on init.
+func register(name string, configured func(*config.FileOutput) bool, create func(*config.FileOutput) (Uploader, error)) {
+	backends = append(backends, &backend{
+		name:       name,
+		configured: configured,
+		create:     create,
+	})
+}
+
+// New returns an uploader for the configured storage, or nil if recordings are kept locally
+func New(conf *config.FileOutput) (Uploader, error) {
+	var selected *backend
+	for _, b := range backends {
+		if !b.configured(conf) {
+			continue
+		}
+		if selected != nil {
+			return nil, fmt.Errorf("%w: %s and %s", ErrMultipleStorage, selected.name, b.name)
+		}
+		selected = b
+	}
+	if selected == nil {
+		return nil, nil
+	}
+	return selected.create(conf)
+}
+
+// openFile opens a file for upload, along with its size
+func openFile(localPath string) (*os.File, int64, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func statusError(method, location string, status string) error {
+	return fmt.Errorf("%w: %s %s returned %s", ErrUploadFailed, method, location, status)
+}
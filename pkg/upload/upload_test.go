@@ -0,0 +1,245 @@
+package upload
+
+import (
+	"crypto/ed25519"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+)
+
+func TestNew(t *testing.T) {
+	uploader, err := New(&config.FileOutput{Local: true})
+	require.NoError(t, err)
+	require.Nil(t, uploader)
+
+	uploader, err = New(&config.FileOutput{Directory: &config.DirectoryConfig{Path: t.TempDir()}})
+	require.NoError(t, err)
+	require.IsType(t, &directoryUploader{}, uploader)
+
+	_, err = New(&config.FileOutput{
+		S3:        &config.S3Config{},
+		Directory: &config.DirectoryConfig{Path: t.TempDir()},
+	})
+	require.ErrorIs(t, err, ErrMultipleStorage)
+}
+
+func TestDirectoryUpload(t *testing.T) {
+	localPath := writeFile(t, "recording")
+	dir := t.TempDir()
+
+	uploader, err := New(&config.FileOutput{Directory: &config.DirectoryConfig{Path: dir}})
+	require.NoError(t, err)
+	location, err := uploader.Upload(localPath, "room/recording.mp4", "video/mp4")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "room", "recording.mp4"), location)
+
+	data, err := os.ReadFile(location)
+	require.NoError(t, err)
+	require.Equal(t, "recording", string(data))
+	require.NoFileExists(t, localPath)
+}
+
+func TestGatewayUpload(t *testing.T) {
+	var received *http.Request
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer server.Close()
+
+	uploader, err := New(&config.FileOutput{Gateway: &config.GatewayConfig{
+		Url:     server.URL + "/uploads/{path}?signature=secret",
+		Headers: map[string]string{"X-Api-Key": "key"},
+	}})
+	require.NoError(t, err)
+
+	location, err := uploader.Upload(writeFile(t, "recording"), "room/my recording.mp4", "video/mp4")
+	require.NoError(t, err)
+	require.Equal(t, server.URL+"/uploads/room/my%20recording.mp4", location)
+
+	require.Equal(t, http.MethodPut, received.Method)
+	require.Equal(t, "secret", received.URL.Query().Get("signature"))
+	require.Equal(t, "key", received.Header.Get("X-Api-Key"))
+	require.Equal(t, "video/mp4", received.Header.Get("Content-Type"))
+	require.Equal(t, "recording", body)
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	_, err = uploader.Upload(writeFile(t, "recording"), "recording.mp4", "video/mp4")
+	require.ErrorIs(t, err, ErrUploadFailed)
+	require.NotContains(t, err.Error(), "secret")
+
+	release := make(chan struct{})
+	defer close(release)
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	uploader, err = New(&config.FileOutput{Gateway: &config.GatewayConfig{
+		Url:     server.URL + "/uploads/{path}",
+		Timeout: time.Millisecond * 100,
+	}})
+	require.NoError(t, err)
+	_, err = uploader.Upload(writeFile(t, "recording"), "recording.mp4", "video/mp4")
+	require.Error(t, err)
+}
+
+func TestPresignedUpload(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method != http.MethodPut || r.URL.Query().Get("X-Amz-Signature") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		received[r.URL.Path] = string(b)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	uploader, err := NewPresigned(&config.FileOutput{Directory: &config.DirectoryConfig{Path: dir}}, map[string]string{
+		"room/recording.mp4": server.URL + "/bucket/abc.mp4?X-Amz-Signature=secret",
+	})
+	require.NoError(t, err)
+
+	location, err := uploader.Upload(writeFile(t, "recording"), "room/recording.mp4", "video/mp4")
+	require.NoError(t, err)
+	require.Equal(t, server.URL+"/bucket/abc.mp4", location)
+	require.Equal(t, "recording", received["/bucket/abc.mp4"])
+
+	// files without a url go to the configured storage
+	location, err = uploader.Upload(writeFile(t, "metadata"), "room/recording.json", "application/json")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "room", "recording.json"), location)
+
+	// or are kept locally
+	uploader, err = NewPresigned(&config.FileOutput{Local: true}, map[string]string{
+		"room/recording.mp4": server.URL + "/bucket/abc.mp4?X-Amz-Signature=wrong",
+	})
+	require.NoError(t, err)
+	location, err = uploader.Upload(writeFile(t, "metadata"), "room/recording.json", "application/json")
+	require.NoError(t, err)
+	require.Empty(t, location)
+
+	_, err = uploader.Upload(writeFile(t, "recording"), "room/recording.mp4", "video/mp4")
+	require.ErrorIs(t, err, ErrUploadFailed)
+	require.NotContains(t, err.Error(), "wrong")
+
+	// client errors don't leak the signature either
+	uploader, err = NewPresigned(&config.FileOutput{Local: true}, map[string]string{
+		"room/recording.mp4": "http://127.0.0.1:1/bucket/abc.mp4?X-Amz-Signature=secret",
+	})
+	require.NoError(t, err)
+	_, err = uploader.Upload(writeFile(t, "recording"), "room/recording.mp4", "video/mp4")
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "secret")
+}
+
+func TestSFTPTimeout(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+
+	// the server accepts connections, but never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	uploader, err := New(&config.FileOutput{SFTP: &config.SFTPConfig{
+		Address:  listener.Addr().String(),
+		Username: "recorder",
+		Password: "secret",
+		HostKey:  string(ssh.MarshalAuthorizedKey(signer.PublicKey())),
+		Timeout:  time.Millisecond * 100,
+	}})
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := uploader.Upload(writeFile(t, "recording"), "recording.mp4", "video/mp4")
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		require.Error(t, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("upload did not time out")
+	}
+}
+
+func TestWebDAVUpload(t *testing.T) {
+	var mu sync.Mutex
+	collections := map[string]bool{"/dav/": true}
+	files := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if user, pass, ok := r.BasicAuth(); !ok || user != "recorder" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		parent := r.URL.Path[:strings.LastIndex(strings.TrimSuffix(r.URL.Path, "/"), "/")+1]
+		switch {
+		case !collections[parent]:
+			w.WriteHeader(http.StatusConflict)
+		case r.Method == "MKCOL" && collections[r.URL.Path]:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case r.Method == "MKCOL":
+			collections[r.URL.Path] = true
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPut:
+			b, _ := io.ReadAll(r.Body)
+			files[r.URL.Path] = string(b)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer server.Close()
+
+	uploader, err := New(&config.FileOutput{WebDAV: &config.WebDAVConfig{
+		Url:      server.URL + "/dav/",
+		Username: "recorder",
+		Password: "secret",
+	}})
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		location, err := uploader.Upload(writeFile(t, "recording"), "rooms/room/recording.mp4", "video/mp4")
+		require.NoError(t, err)
+		require.Equal(t, server.URL+"/dav/rooms/room/recording.mp4", location)
+	}
+	require.Equal(t, map[string]string{"/dav/rooms/room/recording.mp4": "recording"}, files)
+}
+
+func writeFile(t *testing.T, data string) string {
+	localPath := filepath.Join(t.TempDir(), "recording.mp4")
+	require.NoError(t, os.WriteFile(localPath, []byte(data), 0644))
+	return localPath
+}
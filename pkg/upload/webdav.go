@@ -0,0 +1,66 @@
+package upload
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/livekit/livekit-recorder/pkg/config"
+)
+
+func init() {
+	register("webdav",
+		func(conf *config.FileOutput) bool { return conf.WebDAV != nil },
+		func(conf *config.FileOutput) (Uploader, error) {
+			return &webdavUploader{conf: conf.WebDAV, client: newClient(conf.WebDAV.Timeout)}, nil
+		},
+	)
+}
+
+type webdavUploader struct {
+	conf   *config.WebDAVConfig
+	client *http.Client
+}
+
+func (u *webdavUploader) Upload(localPath, storagePath, contentType string) (string, error) {
+	base := strings.TrimSuffix(u.conf.Url, "/")
+	storagePath = escapePath(strings.TrimPrefix(storagePath, "/"))
+
+	// parent collections must exist before putting a file
+	segments := strings.Split(storagePath, "/")
+	for i := 1; i < len(segments); i++ {
+		if err := u.mkcol(base + "/" + strings.Join(segments[:i], "/") + "/"); err != nil {
+			return "", err
+		}
+	}
+
+	location := base + "/" + storagePath
+	if err := put(u.client, location, localPath, contentType, u.authorize); err != nil {
+		return "", err
+	}
+	return stripSecrets(location), nil
+}
+
+// mkcol creates a collection. Existing collections are left as they are.
+func (u *webdavUploader) mkcol(location string) error {
+	req, err := http.NewRequest("MKCOL", location, nil)
+	if err != nil {
+		return err
+	}
+	u.authorize(req)
+
+	res, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode == http.StatusCreated || res.StatusCode == http.StatusMethodNotAllowed {
+		return nil
+	}
+	return statusError("MKCOL", stripSecrets(location), res.Status)
+}
+
+func (u *webdavUploader) authorize(req *http.Request) {
+	if u.conf.Username != "" {
+		req.SetBasicAuth(u.conf.Username, u.conf.Password)
+	}
+}
@@ -25,6 +25,11 @@ api_key: key
 api_secret: secret
 ws_url: ws://localhost:7880`
 
+var testSourceConf = `
+source:
+  type: test
+  video_pattern: ball`
+
 func TestRecorder(t *testing.T) {
 	conf, err := config.NewConfig(confString)
 	require.NoError(t, err)
@@ -67,6 +72,14 @@ func TestRecorder(t *testing.T) {
 				testRecording(t, conf, nil, "file-static", true)
 			},
 		},
+		{
+			name: "file-test-source",
+			f: func(t *testing.T) {
+				testConf, err := config.NewConfig(confString + testSourceConf)
+				require.NoError(t, err)
+				testRecording(t, testConf, nil, "file-test-source", false)
+			},
+		},
 		{
 			name: "stream-default",
 			f:    func(t *testing.T) { testStream(t, conf) },
@@ -13,10 +13,10 @@ export interface ConnectionParams {
 export function onConnected(room: Room) {
   if (room.participants.size > 0) {
     startRecording();
-  } else {
-    room.once(RoomEvent.ParticipantConnected, startRecording);
   }
 
+  // the recorder ignores repeated messages, and waits for participants to rejoin an empty room
+  room.on(RoomEvent.ParticipantConnected, startRecording);
   room.on(RoomEvent.ParticipantDisconnected, () => onParticipantDisconnected(room));
 }
 
@@ -34,6 +34,20 @@ export function startRecording() {
   console.log('START_RECORDING');
 }
 
+declare global {
+  interface Window {
+    livekitRecorderRefreshToken?: (token: string) => void;
+  }
+}
+
+// the recorder pushes a new token before the current one expires, so a reloaded page can still join
+window.livekitRecorderRefreshToken = (token: string) => {
+  const [path, search] = window.location.hash.split('?');
+  const query = new URLSearchParams(search);
+  query.set('token', token);
+  window.history.replaceState(null, '', `${path}?${query.toString()}`);
+};
+
 export function useParams(): ConnectionParams {
   const query = new URLSearchParams(useLocation().search);
   return {